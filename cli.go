@@ -0,0 +1,727 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"generator/dto"
+)
+
+const usage = `usage: generator <command> [flags]
+
+commands:
+  gen    生成代码，已存在的文件与上次生成的结果做三方合并
+  list   列出实体及其生成文件
+  diff   输出生成结果与磁盘上文件的差异，等同于 gen -dry-run
+  clean  删除生成的文件，手工修改过的文件与迁移文件需要 -force
+  lint   检查 dto 中的问题，输出所有问题的位置与原因
+  introspect  根据 DDL 文件或数据库中已有的表生成 dto 结构体
+
+退出状态：0 成功；1 -dry-run/diff 发现需要更新的文件，或 lint 发现问题；2 出错；3 gen 写入了冲突标记，需要手工合并
+
+使用 "generator <command> -h" 查看命令参数
+`
+
+// options 命令行参数，与配置文件合并后的结果
+type options struct {
+	Project     string
+	Output      string
+	Input       string
+	Entities    []string
+	Layers      []*layer
+	Framework   string
+	Route       string
+	Dialect     string
+	TimeFormat  string
+	Destructive bool
+	DryRun      bool
+	Force       bool              // clean 时同时删除手工修改过的文件与迁移文件
+	Templates   string            // 覆盖内置模板的目录
+	Types       map[string]string // 当前方言中自定义类型对应的列类型
+	Imports     map[string]string // 自定义类型中的包名对应的 import 路径
+	DDL         string            // introspect 读取的 DDL 文件
+	DSN         string            // introspect 连接的数据库
+	Tables      []string          // introspect 处理的表，默认全部
+	Package     string            // introspect 生成的 dto 包名
+	DTO         string            // introspect 写入的文件，为空时输出到标准输出
+}
+
+// errOutdated 预览时发现生成的代码需要更新
+var errOutdated = errors.New("generated code is out of date")
+
+// errConflict 生成时存在需要手工解决的合并冲突
+var errConflict = errors.New("merge conflicts")
+
+// commands 子命令
+var commands = map[string]func(o *options, w io.Writer) error{
+	"gen":        runGen,
+	"list":       runList,
+	"diff":       runDiff,
+	"clean":      runClean,
+	"lint":       runLint,
+	"introspect": runIntrospect,
+}
+
+// run 解析命令行并执行子命令
+func run(args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(os.Stderr, usage)
+		if len(args) == 0 {
+			return errors.New("missing command")
+		}
+		return nil
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	o, err := parseFlags(args[0], args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	return cmd(o, os.Stdout)
+}
+
+// parseFlags 解析子命令参数，命令行参数优先于配置文件
+func parseFlags(name string, args []string) (*options, error) {
+	var (
+		err      error
+		cfg      *Config
+		all      []*layer
+		o        = &options{}
+		config   string
+		dir      string
+		web      string
+		route    string
+		dialect  string
+		format   string
+		entities string
+		selected string
+		tables   string
+		set      = make(map[string]bool)
+		fs       = flag.NewFlagSet(name, flag.ContinueOnError)
+	)
+	fs.StringVar(&config, "config", defaultConfigFile, "项目配置文件")
+	fs.StringVar(&o.Project, "project", "", "生成代码的 import 前缀，默认读取项目根目录 go.mod 中的 module")
+	fs.StringVar(&o.Output, "out", "..", "项目根目录，生成文件相对于此目录存放")
+	fs.StringVar(&o.Input, "input", "", "dto 源文件、目录、包路径、实体描述文件或包含 CREATE TABLE 语句的 .sql 文件，为空时使用 dto.StructMap")
+	fs.StringVar(&dir, "templates", "", "覆盖内置模板的目录，目录中与内置模板同名的文件会覆盖内置模板")
+	fs.StringVar(&web, "framework", "", "api 层使用的框架：gin、echo、chi、net/http，默认 gin")
+	fs.StringVar(&route, "route", "", "路由风格：rpc（全部为 POST）、rest，默认 rpc")
+	fs.StringVar(&dialect, "dialect", "", "数据库方言：postgres、mysql，默认 postgres")
+	fs.StringVar(&format, "time-format", "", "时间字段在请求与回包中的格式：unix（秒）、millis（毫秒）、rfc3339，默认 unix")
+	fs.StringVar(&entities, "entity", "", "需要处理的实体，多个以逗号分隔，默认全部")
+	fs.StringVar(&selected, "layer", "", "需要处理的层，多个以逗号分隔，默认为配置中启用的层")
+	fs.BoolVar(&o.Destructive, "allow-destructive", false, "允许生成删除列、修改列类型等破坏性的增量迁移")
+	fs.BoolVar(&o.DryRun, "dry-run", false, "只预览，不写入任何文件")
+	if name == "clean" {
+		fs.BoolVar(&o.Force, "force", false, "同时删除生成后手工修改过的文件以及迁移文件")
+	}
+	if name == "introspect" {
+		fs.StringVar(&o.DDL, "ddl", "", "包含 CREATE TABLE 语句的 SQL 文件")
+		fs.StringVar(&o.DSN, "dsn", "", "数据库连接串，按 -dialect 选择驱动，与 -ddl 二选一")
+		fs.StringVar(&tables, "table", "", "需要处理的表，多个以逗号分隔，默认全部")
+		fs.StringVar(&o.Package, "package", "dto", "生成的 dto 包名")
+		fs.StringVar(&o.DTO, "o", "", "写入的 go 文件，文件已存在时报错，默认输出到标准输出")
+	}
+
+	if err = fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if cfg, err = loadConfig(config, set["config"]); err != nil {
+		return nil, err
+	}
+	if !set["project"] {
+		o.Project = cfg.Module
+	}
+	if !set["out"] && cfg.Output != "" {
+		o.Output = cfg.Output
+	}
+	if !set["input"] {
+		o.Input = cfg.Input
+	}
+	if o.Entities = splitList(entities); !set["entity"] {
+		o.Entities = cfg.Entities
+	}
+	o.Tables = splitList(tables)
+
+	// introspect 不生成代码，不需要 import 前缀
+	if o.Project == "" && name != "introspect" {
+		if o.Project, err = findModule(o.Output); err != nil {
+			return nil, fmt.Errorf("detect module path: %w, use -project instead", err)
+		}
+	}
+
+	if set["templates"] {
+		cfg.Templates = dir
+	}
+	o.Templates = cfg.Templates
+	if set["framework"] {
+		cfg.Framework = web
+	}
+	if set["route"] {
+		cfg.Route = route
+	}
+	if o.Framework, o.Route = cfg.Framework, cfg.Route; o.Route == "" {
+		o.Route = "rpc"
+	}
+	if !contains(routes, o.Route) {
+		return nil, fmt.Errorf("unknown route style %q, available: %s", o.Route, strings.Join(routes, ","))
+	}
+	if set["dialect"] {
+		cfg.Dialect = dialect
+	}
+	if o.Dialect = cfg.Dialect; o.Dialect == "" {
+		o.Dialect = "postgres"
+	}
+	if err = checkDialect(o.Dialect); err != nil {
+		return nil, err
+	}
+	for name := range cfg.Types {
+		if err = checkDialect(name); err != nil {
+			return nil, fmt.Errorf("types: %w", err)
+		}
+	}
+	o.Types, o.Imports = cfg.Types[o.Dialect], cfg.Imports
+	if set["time-format"] {
+		cfg.TimeFormat = format
+	}
+	if o.TimeFormat = cfg.TimeFormat; o.TimeFormat == "" {
+		o.TimeFormat = "unix"
+	}
+	if !contains(timeFormats, o.TimeFormat) {
+		return nil, fmt.Errorf("unknown time format %q, available: %s", o.TimeFormat, strings.Join(timeFormats, ","))
+	}
+	if all, err = cfg.layers(); err != nil {
+		return nil, err
+	}
+	if o.Layers, err = selectLayers(all, splitList(selected)); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// selectLayers 按名称选择层，未指定时返回所有启用的层
+func selectLayers(all []*layer, names []string) ([]*layer, error) {
+	out := make([]*layer, 0, len(all))
+	if len(names) == 0 {
+		for _, l := range all {
+			if l.Enabled {
+				out = append(out, l)
+			}
+		}
+		return out, nil
+	}
+
+	available := make([]string, 0, len(all))
+	for _, l := range all {
+		available = append(available, l.Name)
+	}
+	for _, name := range names {
+		var found *layer
+		for _, l := range all {
+			if l.Name == name {
+				found = l
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("unknown layer %q, available: %s", name, strings.Join(available, ","))
+		}
+		out = append(out, found)
+	}
+	return out, nil
+}
+
+// contains 判断列表中是否包含指定的值
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList 拆分逗号分隔的参数
+func splitList(s string) []string {
+	out := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// load 加载、筛选需要生成的实体，设置生成选项后检查
+func (o *options) load() ([]*Generate, error) {
+	list, err := o.filter()
+	if err != nil {
+		return nil, err
+	}
+	o.apply(list)
+	// 存在问题时不生成任何文件
+	if list := validate(list); len(list) > 0 {
+		return nil, list
+	}
+	return list, nil
+}
+
+// apply 将命令行与配置文件中的生成选项设置到生成模型
+func (o *options) apply(list []*Generate) {
+	var (
+		i   int
+		now = time.Now()
+	)
+	for _, generator := range list {
+		// 中间表在声明关联的实体之后依次生成迁移文件
+		for _, g := range append([]*Generate{generator}, generator.Joins()...) {
+			g.Framework, g.Route, g.Dialect = o.Framework, o.Route, o.Dialect
+			g.Version, g.Destructive = newVersion(now, i), o.Destructive
+			g.Types, g.Packages, g.TimeFormat = o.Types, o.Imports, o.TimeFormat
+			i++
+		}
+	}
+}
+
+// filter 加载并筛选需要生成的实体
+func (o *options) filter() ([]*Generate, error) {
+	var (
+		err  error
+		list = make([]*Generate, 0)
+	)
+
+	if o.Input == "" {
+		for _, v := range dto.StructMap {
+			var generator *Generate
+			if generator, err = newGenerate(o.Project, v); err != nil {
+				return nil, err
+			}
+			list = append(list, generator)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].TitleName < list[j].TitleName })
+		relate(list)
+		// StructMap 中的结构体都是实体，缺少 Id 字段时由 validate 报错
+		return o.selectEntities(list)
+	} else if strings.EqualFold(filepath.Ext(o.Input), ".sql") {
+		if list, err = loadDDL(o.Project, o.Input, o.Dialect); err != nil {
+			return nil, err
+		}
+	} else if list, err = loadSource(o.Project, o.Input); err != nil {
+		return nil, err
+	}
+	relate(list)
+
+	// 未指定实体时只处理包含 Id 字段的结构体
+	if len(o.Entities) == 0 {
+		out := make([]*Generate, 0, len(list))
+		for _, generator := range list {
+			if generator.HasID() {
+				out = append(out, generator)
+			}
+		}
+		return out, nil
+	}
+	return o.selectEntities(list)
+}
+
+// selectEntities 按名称选择实体，未指定时返回全部实体
+func (o *options) selectEntities(list []*Generate) ([]*Generate, error) {
+	if len(o.Entities) == 0 {
+		return list, nil
+	}
+	out := make([]*Generate, 0, len(o.Entities))
+	for _, name := range o.Entities {
+		var found *Generate
+		for _, generator := range list {
+			if generator.TitleName == name {
+				found = generator
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("entity %s not found", name)
+		}
+		out = append(out, found)
+	}
+	return out, nil
+}
+
+// outputs 渲染所有选中的实体
+func (o *options) outputs() ([]*output, error) {
+	var (
+		err  error
+		list []*Generate
+		out  = make([]*output, 0)
+	)
+	if list, err = o.load(); err != nil {
+		return nil, err
+	}
+	for _, generator := range list {
+		var files []*output
+		if files, err = render(o.Output, generator, o.Layers); err != nil {
+			return nil, err
+		}
+		out = append(out, files...)
+	}
+	return combine(out)
+}
+
+// runGen 生成代码
+func runGen(o *options, w io.Writer) error {
+	if o.DryRun {
+		return runDiff(o, w)
+	}
+
+	files, err := o.outputs()
+	if err != nil {
+		return err
+	}
+	conflicts := 0
+	for _, f := range files {
+		var st status
+		if st, err = generate(f); err != nil {
+			return err
+		}
+		if st == statusConflict {
+			conflicts++
+		}
+		if !o.internal(f.Path) {
+			fmt.Fprintf(w, "%-9s %s\n", st, f.Path)
+		}
+	}
+	if conflicts > 0 {
+		return fmt.Errorf("%w: %d file(s) have conflict markers, resolve them and run again", errConflict, conflicts)
+	}
+	return nil
+}
+
+// runLint 检查选中的实体，输出所有问题，存在问题时返回 errInvalid
+func runLint(o *options, w io.Writer) error {
+	list, err := o.filter()
+	if err != nil {
+		return err
+	}
+	o.apply(list)
+	found := validate(list)
+	for _, p := range found {
+		fmt.Fprintln(w, p)
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("%w: %d problem(s) found in %d entities", errInvalid, len(found), len(list))
+	}
+	fmt.Fprintf(w, "%d entities ok\n", len(list))
+	return nil
+}
+
+// runList 列出实体及其生成文件
+func runList(o *options, w io.Writer) error {
+	list, err := o.load()
+	if err != nil {
+		return err
+	}
+	for _, generator := range list {
+		fmt.Fprintf(w, "%s\n", generator.TitleName)
+		for _, l := range o.Layers {
+			for _, part := range l.parts() {
+				fmt.Fprintf(w, "  %-8s %s\n", l.Name, layerPath(o.Output, l, generator, part))
+			}
+			if !l.Versioned {
+				continue
+			}
+			for _, join := range generator.Joins() {
+				for _, part := range l.parts() {
+					fmt.Fprintf(w, "  %-8s %s\n", l.Name, layerPath(o.Output, l, join, part))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// runDiff 输出生成结果与磁盘上文件的差异及汇总，存在需要更新的文件时返回 errOutdated
+func runDiff(o *options, w io.Writer) error {
+	files, err := o.outputs()
+	if err != nil {
+		return err
+	}
+
+	count := make(map[status]int)
+	for _, f := range files {
+		var (
+			st  status
+			src []byte
+			old []byte
+		)
+		if st, src, err = plan(f); err != nil {
+			return err
+		}
+		// 表结构快照等生成器内部状态随生成结果一起更新，不做为需要用户处理的变更
+		if o.internal(f.Path) {
+			continue
+		}
+		count[st]++
+
+		oldName, newName := "a/"+o.relPath(f.Path), "b/"+o.relPath(f.Path)
+		switch st {
+		case statusCreated:
+			oldName = "/dev/null"
+		case statusUpdated, statusConflict:
+			if old, err = os.ReadFile(f.Path); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		fmt.Fprint(w, unifiedDiff(oldName, newName, old, src))
+	}
+
+	fmt.Fprintf(w, "%d created, %d changed, %d conflict, %d unchanged, %d skipped\n",
+		count[statusCreated], count[statusUpdated], count[statusConflict], count[statusUnchanged], count[statusSkipped])
+	if count[statusCreated]+count[statusUpdated]+count[statusConflict] > 0 {
+		return errOutdated
+	}
+	return nil
+}
+
+// internal 是否为 .generator 中的生成器内部状态文件
+func (o *options) internal(path string) bool {
+	return strings.HasPrefix(o.relPath(path), stateDir+"/")
+}
+
+// relPath 返回相对于项目根目录的路径
+func (o *options) relPath(path string) string {
+	if rel, err := filepath.Rel(o.Output, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
+
+// runClean 删除生成的文件
+//   - 与上次生成的原始内容不同的文件（手工修改或受保护区域中有内容）默认保留
+//   - 迁移文件可能已经在数据库中执行，删除会破坏迁移历史，默认保留
+func runClean(o *options, w io.Writer) error {
+	list, err := o.load()
+	if err != nil {
+		return err
+	}
+	for _, generator := range list {
+		for _, l := range o.Layers {
+			if l.File != "" {
+				if err = o.cleanShared(w, l, generator); err != nil {
+					return err
+				}
+				continue
+			}
+			if l.Versioned && !o.Force {
+				if fileExists(layerPath(o.Output, l, generator, l.parts()[0])) {
+					fmt.Fprintf(w, "skip   %s migrations of %s, run with -force to remove\n", l.Name, generator.Table())
+				}
+				continue
+			}
+			for _, part := range l.parts() {
+				if err = o.remove(w, l, generator, part); err != nil {
+					return err
+				}
+			}
+			if !l.Versioned {
+				continue
+			}
+			if err = o.cleanMigration(w, l, generator); err != nil {
+				return err
+			}
+			// 中间表的迁移文件随声明关联的实体一起删除
+			for _, join := range generator.Joins() {
+				for _, part := range l.parts() {
+					if err = o.remove(w, l, join, part); err != nil {
+						return err
+					}
+				}
+				if err = o.cleanMigration(w, l, join); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// remove 删除单个生成文件及其原始内容，文件与原始内容不同时需要 -force
+func (o *options) remove(w io.Writer, l *layer, generator *Generate, part string) error {
+	var (
+		filename = layerPath(o.Output, l, generator, part)
+		baseline = baselinePath(o.Output, l, generator, part)
+	)
+	old, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !o.Force {
+		base, err := os.ReadFile(baseline)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if base == nil || !bytes.Equal(old, base) {
+			fmt.Fprintf(w, "skip   %s modified since generated, run with -force to remove\n", filename)
+			return nil
+		}
+	}
+	fmt.Fprintf(w, "remove %s\n", filename)
+	if o.DryRun {
+		return nil
+	}
+	if err = os.Remove(baseline); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(filename)
+}
+
+// cleanShared 从共用文件中删除实体对应的内容
+func (o *options) cleanShared(w io.Writer, l *layer, generator *Generate) error {
+	var (
+		err   error
+		old   []byte
+		src   []byte
+		files []*output
+	)
+	filename := layerPath(o.Output, l, generator, "")
+	if old, err = os.ReadFile(filename); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if files, err = render(o.Output, generator, []*layer{l}); err != nil {
+		return err
+	}
+	if src, err = removeOpenAPI(old, files[0].Src); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	if bytes.Equal(src, old) {
+		return nil
+	}
+	fmt.Fprintf(w, "remove %s from %s\n", generator.TitleName, filename)
+	if o.DryRun {
+		return nil
+	}
+	return writeFile(filename, src)
+}
+
+// cleanMigration 删除实体的增量迁移文件与表结构快照，只在 -force 时调用
+func (o *options) cleanMigration(w io.Writer, l *layer, generator *Generate) error {
+	files, err := filepath.Glob(filepath.Join(o.Output, l.Path, "*_alter_"+generator.Table()+".*"))
+	if err != nil {
+		return err
+	}
+	for _, filename := range append(files, schemaPath(o.Output, generator)) {
+		if !fileExists(filename) {
+			continue
+		}
+		fmt.Fprintf(w, "remove %s\n", filename)
+		if o.DryRun {
+			continue
+		}
+		if err = os.Remove(filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runIntrospect 读取 DDL 文件或数据库中的表结构，生成 dto 结构体
+func runIntrospect(o *options, w io.Writer) error {
+	var (
+		err     error
+		src     []byte
+		schemas []*Schema
+		p       *template.Template
+		file    = &dtoFile{Package: o.Package, Source: o.DDL, Entities: make([]*dtoEntity, 0)}
+	)
+	switch {
+	case o.DDL != "" && o.DSN != "":
+		return errors.New("-ddl and -dsn are mutually exclusive")
+	case o.DDL != "":
+		if src, err = os.ReadFile(o.DDL); err != nil {
+			return err
+		}
+		if schemas, err = parseDDL(src, o.Dialect); err != nil {
+			return fmt.Errorf("%s: %w", o.DDL, err)
+		}
+		file.Source = filepath.Base(o.DDL)
+	case o.DSN != "":
+		if schemas, err = loadDatabase(o.Dialect, o.DSN); err != nil {
+			return fmt.Errorf("introspect %s database: %w", o.Dialect, err)
+		}
+		file.Source = o.Dialect + " 数据库"
+	default:
+		return errors.New("missing -ddl or -dsn")
+	}
+
+	for _, name := range o.Tables {
+		found := false
+		for _, schema := range schemas {
+			found = found || schema.Table == name
+		}
+		if !found {
+			return fmt.Errorf("table %s not found", name)
+		}
+	}
+	for _, schema := range schemas {
+		if len(o.Tables) == 0 || contains(o.Tables, schema.Table) {
+			file.Entities = append(file.Entities, newDtoEntity(schema))
+		}
+	}
+	if len(file.Entities) == 0 {
+		return errors.New("no table found")
+	}
+
+	var buf bytes.Buffer
+	if p, err = newTemplate("dto", o.Templates); err != nil {
+		return err
+	}
+	if err = p.Execute(&buf, file); err != nil {
+		return err
+	}
+	if src, err = formatSource("dto.go", buf.Bytes()); err != nil {
+		return err
+	}
+	if o.DTO == "" {
+		_, err = w.Write(src)
+		return err
+	}
+	if fileExists(o.DTO) {
+		return fmt.Errorf("%s already exists", o.DTO)
+	}
+	if err = writeFile(o.DTO, src); err != nil {
+		return err
+	}
+	for _, e := range file.Entities {
+		fmt.Fprintf(w, "%-9s %s => %s\n", "introspect", e.Table, e.TitleName)
+	}
+	fmt.Fprintf(w, "%-9s %s\n", statusCreated, o.DTO)
+	return nil
+}
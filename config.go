@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile 默认配置文件名
+const defaultConfigFile = "generator.yaml"
+
+// Config 项目配置，对应 generator.yaml
+type Config struct {
+	Module     string                       `yaml:"module"`      // import 前缀，为空时读取 go.mod
+	Output     string                       `yaml:"output"`      // 项目根目录，相对于配置文件所在目录
+	Input      string                       `yaml:"input"`       // dto 源文件、目录、包路径、实体描述文件或 .sql 文件
+	Templates  string                       `yaml:"templates"`   // 覆盖内置模板的目录
+	Framework  string                       `yaml:"framework"`   // api 层使用的框架：gin、echo、chi、net/http
+	Route      string                       `yaml:"route"`       // 路由风格：rpc（默认，全部为 POST）、rest
+	Dialect    string                       `yaml:"dialect"`     // 数据库方言：postgres（默认）、mysql
+	TimeFormat string                       `yaml:"time_format"` // 时间字段在请求与回包中的格式：unix（默认）、millis、rfc3339
+	Entities   []string                     `yaml:"entities"`    // 需要生成的实体
+	Layers     map[string]*Layer            `yaml:"layers"`      // 各层配置，未配置的层使用默认值
+	Types      map[string]map[string]string `yaml:"types"`       // 各方言中自定义类型对应的列类型，覆盖内置的类型映射
+	Imports    map[string]string            `yaml:"imports"`     // 自定义类型中的包名对应的 import 路径
+}
+
+// Layer 层配置
+type Layer struct {
+	Path     string `yaml:"path"`     // 存储目录，相对于项目根目录
+	Template string `yaml:"template"` // 内置模板名称或模板文件路径
+	Ext      string `yaml:"ext"`      // 生成文件的扩展名，默认为 .go
+	File     string `yaml:"file"`     // 所有实体共用的文件名，仅支持 YAML 文档
+	Enabled  *bool  `yaml:"enabled"`  // 是否默认生成，为空时使用内置层的默认值
+}
+
+// layer 解析后的层
+type layer struct {
+	Name      string
+	Path      string
+	Template  *template.Template
+	Ext       string
+	File      string // 所有实体共用的文件名，为空时每个实体一个文件
+	Versioned bool   // 文件名是否带有版本号
+	Enabled   bool
+}
+
+// parts 分开生成的部分，模板主体为空且定义了 up 与 down 时分别生成两个文件，否则只生成一个文件
+func (l *layer) parts() []string {
+	if l.Template.Lookup("up") == nil || l.Template.Lookup("down") == nil {
+		return []string{""}
+	}
+	if l.Template.Tree != nil && strings.TrimSpace(l.Template.Tree.Root.String()) != "" {
+		return []string{""}
+	}
+	return []string{"up", "down"}
+}
+
+// ext 生成文件的扩展名
+func (l *layer) ext() string {
+	if l.Ext == "" {
+		return ".go"
+	}
+	return l.Ext
+}
+
+// loadConfig 读取配置文件，文件不存在且未显式指定时返回空配置
+func loadConfig(filename string, explicit bool) (*Config, error) {
+	var (
+		err  error
+		data []byte
+		c    = &Config{}
+	)
+	if data, err = os.ReadFile(filename); err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return c, nil
+		}
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	// 配置中的相对路径以配置文件所在目录为准
+	dir := filepath.Dir(filename)
+	if c.Output != "" && !filepath.IsAbs(c.Output) {
+		c.Output = filepath.Join(dir, c.Output)
+	}
+	if c.Templates != "" && !filepath.IsAbs(c.Templates) {
+		c.Templates = filepath.Join(dir, c.Templates)
+	}
+	if c.Input != "" && !filepath.IsAbs(c.Input) {
+		// 包路径保持不变，只处理本地路径
+		if p := filepath.Join(dir, c.Input); strings.HasPrefix(c.Input, ".") || fileExists(p) {
+			c.Input = p
+		}
+	}
+	for name, l := range c.Layers {
+		if l == nil {
+			return nil, fmt.Errorf("%s: layer %s is empty", filename, name)
+		}
+		if _, ok := builtinTemplate(l.Template); l.Template != "" && !ok && !filepath.IsAbs(l.Template) {
+			l.Template = filepath.Join(dir, l.Template)
+		}
+	}
+	return c, nil
+}
+
+// layers 合并默认层与配置中的层，内置层在前，自定义层按名称排序
+func (c *Config) layers() ([]*layer, error) {
+	var (
+		out   = make([]*layer, 0, len(layers)+len(c.Layers))
+		extra = make([]string, 0)
+	)
+	if c.Framework != "" {
+		if _, ok := frameworks[c.Framework]; !ok {
+			return nil, fmt.Errorf("unknown framework %q, available: gin, echo, chi, net/http", c.Framework)
+		}
+	}
+	for name := range c.Layers {
+		if _, ok := addr[name]; !ok {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+
+	for _, name := range append(append([]string{}, layers...), extra...) {
+		var (
+			err  error
+			l    = &layer{Name: name, Path: addr[name], Ext: exts[name], File: files[name], Versioned: contains(versioned, name), Enabled: !contains(disabled, name)}
+			temp = m[name]
+			cfg  = c.Layers[name]
+		)
+		if name == "api" && c.Framework != "" {
+			temp = frameworks[c.Framework]
+		}
+		if cfg != nil {
+			if cfg.Path != "" {
+				l.Path = cfg.Path
+			}
+			if cfg.Ext != "" {
+				l.Ext = "." + strings.TrimPrefix(cfg.Ext, ".")
+			}
+			if cfg.File != "" {
+				l.File = cfg.File
+			}
+			if cfg.Enabled != nil {
+				l.Enabled = *cfg.Enabled
+			}
+			// 配置的是该层的默认内置模板时（如 api 层的 template: api），仍由 framework 选择模板
+			if file, ok := builtinTemplate(cfg.Template); cfg.Template != "" && !(ok && file == m[name]) {
+				temp = cfg.Template
+			}
+		}
+		if l.Path == "" || temp == "" {
+			return nil, fmt.Errorf("layer %s: path and template are required", name)
+		}
+		if ext := filepath.Ext(l.File); l.File != "" && ext != ".yaml" && ext != ".yml" {
+			return nil, fmt.Errorf("layer %s: shared file %s must be a yaml document", name, l.File)
+		}
+		if l.Template, err = newTemplate(temp, c.Templates); err != nil {
+			return nil, fmt.Errorf("layer %s: %w", name, err)
+		}
+		out = append(out, l)
+	}
+	return out, nil
+}
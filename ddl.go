@@ -0,0 +1,636 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ddlToken DDL 中的词法单元
+type ddlToken struct {
+	kind int    // tokenWord、tokenIdent、tokenString、tokenSymbol
+	text string // 字符串与带引号的标识符为去掉引号后的内容
+	line int
+}
+
+const (
+	tokenWord   = iota // 关键字、未加引号的标识符与数字
+	tokenIdent         // 带引号的标识符
+	tokenString        // 字符串
+	tokenSymbol        // 符号
+)
+
+// typeEnd 列定义中类型之后的关键字，用于确定类型的结束位置
+var typeEnd = []string{
+	"NOT", "NULL", "PRIMARY", "UNIQUE", "KEY", "DEFAULT", "COMMENT", "AUTO_INCREMENT", "AUTOINCREMENT",
+	"REFERENCES", "CHECK", "CONSTRAINT", "GENERATED", "COLLATE", "CHARSET", "ON", "AS",
+}
+
+// parseDDL 解析 CREATE TABLE 语句，返回其中的表结构，支持 Postgres 与 MySQL 方言
+//   - 列上的 PRIMARY KEY、NOT NULL、DEFAULT、UNIQUE、COMMENT 与表上的 COMMENT
+//   - 表定义中以及 CREATE INDEX、ALTER TABLE ... ADD 中的单列主键、唯一约束与索引
+//   - Postgres 的 COMMENT ON TABLE/COLUMN
+//
+// 其余语句与无法识别的约束会被忽略
+func parseDDL(src []byte, dialect string) ([]*Schema, error) {
+	tokens, err := lexDDL(string(src), dialect == "mysql")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ddlParser{dialect: dialect, tables: make(map[string]*Schema)}
+	start := 0
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) && !tokens[i].is(";") {
+			continue
+		}
+		if i > start {
+			if err = p.statement(&cursor{tokens: tokens[start:i]}); err != nil {
+				return nil, fmt.Errorf("line %d: %w", tokens[start].line, err)
+			}
+		}
+		start = i + 1
+	}
+	return p.list, nil
+}
+
+// lexDDL 将 DDL 拆分为词法单元，跳过注释，escape 表示字符串中的反斜杠为转义字符（MySQL）
+func lexDDL(src string, escape bool) ([]ddlToken, error) {
+	var (
+		line   = 1
+		runes  = []rune(src)
+		tokens = make([]ddlToken, 0)
+	)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+		case unicode.IsSpace(r):
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-', r == '#':
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			start := line
+			for i += 2; i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/'); i++ {
+				if runes[i] == '\n' {
+					line++
+				}
+			}
+			if i+1 >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated comment", start)
+			}
+			i++
+		case r == '\'' || r == '"' || r == '`':
+			var (
+				text  strings.Builder
+				start = line
+				kind  = tokenIdent
+				done  bool
+			)
+			if r == '\'' {
+				kind = tokenString
+			}
+			for i++; i < len(runes); i++ {
+				c := runes[i]
+				if c == '\n' {
+					line++
+				}
+				if c == '\\' && escape && kind == tokenString && i+1 < len(runes) {
+					i++
+					text.WriteRune(runes[i])
+					continue
+				}
+				if c == r {
+					// 连续的两个引号表示引号本身
+					if i+1 < len(runes) && runes[i+1] == r {
+						i++
+						text.WriteRune(r)
+						continue
+					}
+					done = true
+					break
+				}
+				text.WriteRune(c)
+			}
+			if !done {
+				return nil, fmt.Errorf("line %d: unterminated %c", start, r)
+			}
+			tokens = append(tokens, ddlToken{kind: kind, text: text.String(), line: start})
+		case isWordRune(r):
+			j := i
+			for j < len(runes) && (isWordRune(runes[j]) || (runes[j] == '.' && unicode.IsDigit(runes[i]))) {
+				j++
+			}
+			tokens = append(tokens, ddlToken{kind: tokenWord, text: string(runes[i:j]), line: line})
+			i = j - 1
+		default:
+			tokens = append(tokens, ddlToken{kind: tokenSymbol, text: string(r), line: line})
+		}
+	}
+	return tokens, nil
+}
+
+// isWordRune 是否为关键字或标识符中的字符
+func isWordRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// is 是否为指定的符号或关键字，关键字不区分大小写
+func (t ddlToken) is(text string) bool {
+	switch t.kind {
+	case tokenSymbol:
+		return t.text == text
+	case tokenWord:
+		return strings.EqualFold(t.text, text)
+	}
+	return false
+}
+
+// cursor 单条语句中的词法单元
+type cursor struct {
+	tokens []ddlToken
+	pos    int
+}
+
+// done 是否已经读取完所有词法单元
+func (c *cursor) done() bool {
+	return c.pos >= len(c.tokens)
+}
+
+// peek 返回第 n 个未读取的词法单元，超出范围时返回空的词法单元
+func (c *cursor) peek(n int) ddlToken {
+	if c.pos+n < len(c.tokens) {
+		return c.tokens[c.pos+n]
+	}
+	return ddlToken{kind: -1}
+}
+
+// next 读取一个词法单元
+func (c *cursor) next() ddlToken {
+	t := c.peek(0)
+	c.pos++
+	return t
+}
+
+// accept 依次匹配关键字，全部匹配时读取并返回 true
+func (c *cursor) accept(words ...string) bool {
+	for i, w := range words {
+		if !c.peek(i).is(w) {
+			return false
+		}
+	}
+	c.pos += len(words)
+	return true
+}
+
+// group 读取括号中的内容，当前位置不是左括号时返回 nil
+func (c *cursor) group() ([]ddlToken, error) {
+	if !c.peek(0).is("(") {
+		return nil, nil
+	}
+	depth := 0
+	for i := c.pos; i < len(c.tokens); i++ {
+		switch {
+		case c.tokens[i].is("("):
+			depth++
+		case c.tokens[i].is(")"):
+			if depth--; depth == 0 {
+				out := c.tokens[c.pos+1 : i]
+				c.pos = i + 1
+				return out, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unbalanced parentheses")
+}
+
+// ddlParser 解析过程中的表结构
+type ddlParser struct {
+	dialect string
+	tables  map[string]*Schema
+	list    []*Schema
+}
+
+// statement 解析单条语句
+func (p *ddlParser) statement(c *cursor) error {
+	switch {
+	case c.accept("CREATE"):
+		c.accept("TEMPORARY")
+		c.accept("TEMP")
+		c.accept("UNLOGGED")
+		unique := c.accept("UNIQUE")
+		switch {
+		case c.accept("TABLE"):
+			return p.createTable(c)
+		case c.accept("INDEX"):
+			return p.createIndex(c, unique)
+		}
+	case c.accept("ALTER", "TABLE"):
+		return p.alterTable(c)
+	case c.accept("COMMENT", "ON"):
+		return p.comment(c)
+	}
+	return nil
+}
+
+// createTable 解析 CREATE TABLE 语句
+func (p *ddlParser) createTable(c *cursor) error {
+	c.accept("IF", "NOT", "EXISTS")
+	names, err := p.name(c)
+	if err != nil {
+		return err
+	}
+	body, err := c.group()
+	if err != nil || body == nil {
+		// CREATE TABLE ... AS SELECT 等语句没有列定义
+		return err
+	}
+
+	schema := &Schema{Dialect: p.dialect, Table: names[len(names)-1], Columns: make([]*Column, 0)}
+	if strings.HasPrefix(schema.Table, "sqlite_") {
+		// SQLite 内部使用的表，如 sqlite_sequence
+		return nil
+	}
+	for _, def := range splitTokens(body) {
+		if err = p.definition(schema, &cursor{tokens: def}); err != nil {
+			return fmt.Errorf("table %s: %w", schema.Table, err)
+		}
+	}
+	// MySQL 的表选项，如 ENGINE=InnoDB COMMENT='用户'
+	for !c.done() {
+		if c.accept("COMMENT") {
+			c.accept("=")
+			if t := c.next(); t.kind == tokenString {
+				schema.Comment = t.text
+			}
+			continue
+		}
+		c.next()
+	}
+
+	if _, ok := p.tables[schema.Table]; !ok {
+		p.list = append(p.list, schema)
+	} else {
+		for i, s := range p.list {
+			if s.Table == schema.Table {
+				p.list[i] = schema
+			}
+		}
+	}
+	p.tables[schema.Table] = schema
+	return nil
+}
+
+// createIndex 解析 CREATE INDEX 语句，只处理已定义的表上的单列索引
+func (p *ddlParser) createIndex(c *cursor, unique bool) error {
+	c.accept("CONCURRENTLY")
+	c.accept("IF", "NOT", "EXISTS")
+	if !c.peek(0).is("ON") {
+		if _, err := p.name(c); err != nil {
+			return err
+		}
+	}
+	if !c.accept("ON") {
+		return fmt.Errorf("expected ON in CREATE INDEX")
+	}
+	c.accept("ONLY")
+	names, err := p.name(c)
+	if err != nil {
+		return err
+	}
+	if c.accept("USING") {
+		c.next()
+	}
+	columns, err := c.group()
+	if err != nil {
+		return err
+	}
+	markIndex(p.single(p.tables[names[len(names)-1]], columns), false, unique)
+	return nil
+}
+
+// alterTable 解析 ALTER TABLE ... ADD 语句，pg_dump 导出的主键、唯一约束使用这种形式
+func (p *ddlParser) alterTable(c *cursor) error {
+	c.accept("ONLY")
+	c.accept("IF", "EXISTS")
+	names, err := p.name(c)
+	if err != nil {
+		return err
+	}
+	schema, ok := p.tables[names[len(names)-1]]
+	if !ok {
+		return nil
+	}
+	rest := &cursor{tokens: c.tokens[c.pos:]}
+	for _, action := range splitTokens(rest.tokens) {
+		a := &cursor{tokens: action}
+		if !a.accept("ADD") {
+			continue
+		}
+		a.accept("COLUMN")
+		if err = p.definition(schema, a); err != nil {
+			return fmt.Errorf("table %s: %w", schema.Table, err)
+		}
+	}
+	return nil
+}
+
+// comment 解析 Postgres 的 COMMENT ON TABLE/COLUMN 语句
+func (p *ddlParser) comment(c *cursor) error {
+	var (
+		column = c.accept("COLUMN")
+		table  = c.accept("TABLE")
+	)
+	if !column && !table {
+		return nil
+	}
+	names, err := p.name(c)
+	if err != nil {
+		return err
+	}
+	if !c.accept("IS") {
+		return fmt.Errorf("expected IS in COMMENT ON")
+	}
+	text := c.next()
+	if text.kind != tokenString {
+		return nil
+	}
+
+	if table {
+		if schema, ok := p.tables[names[len(names)-1]]; ok {
+			schema.Comment = text.text
+		}
+		return nil
+	}
+	if len(names) < 2 {
+		return fmt.Errorf("COMMENT ON COLUMN requires table.column")
+	}
+	if col := findColumn(p.tables[names[len(names)-2]], names[len(names)-1]); col != nil {
+		col.Comment = text.text
+	}
+	return nil
+}
+
+// definition 解析表定义中的一项：列定义或表级约束
+func (p *ddlParser) definition(schema *Schema, c *cursor) error {
+	if c.accept("CONSTRAINT") {
+		if _, err := p.name(c); err != nil {
+			return err
+		}
+	}
+	switch {
+	case c.accept("PRIMARY", "KEY"):
+		columns, err := c.group()
+		if err != nil {
+			return err
+		}
+		markIndex(p.single(schema, columns), true, false)
+		return nil
+	case c.accept("UNIQUE"):
+		if !c.accept("KEY") {
+			c.accept("INDEX")
+		}
+		return p.indexDefinition(schema, c, true)
+	case c.accept("KEY"), c.accept("INDEX"):
+		return p.indexDefinition(schema, c, false)
+	case c.peek(0).kind == tokenWord && contains([]string{"FOREIGN", "CHECK", "EXCLUDE", "FULLTEXT", "SPATIAL", "LIKE"},
+		strings.ToUpper(c.peek(0).text)):
+		return nil
+	}
+	return p.column(schema, c)
+}
+
+// indexDefinition 解析表定义中的索引，索引名称可以省略
+func (p *ddlParser) indexDefinition(schema *Schema, c *cursor, unique bool) error {
+	if !c.peek(0).is("(") {
+		if _, err := p.name(c); err != nil {
+			return err
+		}
+	}
+	columns, err := c.group()
+	if err != nil {
+		return err
+	}
+	markIndex(p.single(schema, columns), false, unique)
+	return nil
+}
+
+// markIndex 标记列上的主键或索引，同一列上的唯一索引优先于普通索引，主键上的索引会被忽略
+func markIndex(col *Column, primary, unique bool) {
+	switch {
+	case col == nil:
+	case primary:
+		col.Primary, col.NotNull, col.Index, col.Unique = true, true, false, false
+	case col.Primary:
+	case unique:
+		col.Unique, col.Index = true, false
+	case !col.Unique:
+		col.Index = true
+	}
+}
+
+// single 返回约束中唯一的列，约束包含多列或表达式时返回 nil，多列索引与表达式索引会被忽略
+// 列名之后允许出现排序方式与 MySQL 的前缀长度，如 name(10) DESC
+func (p *ddlParser) single(schema *Schema, columns []ddlToken) *Column {
+	parts := splitTokens(columns)
+	if schema == nil || len(parts) != 1 || len(parts[0]) == 0 {
+		return nil
+	}
+	first := parts[0][0]
+	if first.kind != tokenWord && first.kind != tokenIdent {
+		return nil
+	}
+	return findColumn(schema, p.ident(first))
+}
+
+// column 解析列定义
+func (p *ddlParser) column(schema *Schema, c *cursor) error {
+	name := c.next()
+	if name.kind != tokenWord && name.kind != tokenIdent {
+		return fmt.Errorf("unexpected %q in table definition", name.text)
+	}
+	// SQLite 中的列可以没有类型
+	col := &Column{Name: p.ident(name), Type: columnTypeOf(c)}
+
+	for !c.done() {
+		switch {
+		case c.accept("NOT", "NULL"):
+			col.NotNull = true
+		case c.accept("PRIMARY", "KEY"):
+			col.Primary, col.NotNull = true, true
+		case c.accept("UNIQUE"):
+			c.accept("KEY")
+			col.Unique = true
+		case c.accept("DEFAULT"):
+			col.Default = expression(c)
+		case c.accept("COMMENT"):
+			if t := c.next(); t.kind == tokenString {
+				col.Comment = t.text
+			}
+		case c.accept("ON", "UPDATE"):
+			expression(c)
+		case c.accept("REFERENCES"), c.accept("COLLATE"), c.accept("CHARSET"), c.accept("CHARACTER", "SET"), c.accept("CONSTRAINT"):
+			if _, err := p.name(c); err != nil {
+				return err
+			}
+		default:
+			// CHECK (...)、GENERATED ... AS (...) 等不影响列结构的内容
+			if c.next().is("(") {
+				c.pos--
+				if _, err := c.group(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if findColumn(schema, col.Name) != nil {
+		return fmt.Errorf("duplicate column %s", col.Name)
+	}
+	schema.Columns = append(schema.Columns, col)
+	return nil
+}
+
+// name 解析可能带有 schema 前缀的名称，如 public.users
+func (p *ddlParser) name(c *cursor) ([]string, error) {
+	names := make([]string, 0, 2)
+	for {
+		t := c.next()
+		if t.kind != tokenWord && t.kind != tokenIdent {
+			return nil, fmt.Errorf("expected name, got %q", t.text)
+		}
+		names = append(names, p.ident(t))
+		if !c.peek(0).is(".") {
+			return names, nil
+		}
+		c.next()
+	}
+}
+
+// ident 标识符的名称，Postgres 中未加引号的标识符统一转换为小写
+func (p *ddlParser) ident(t ddlToken) string {
+	if t.kind == tokenWord && p.dialect != "mysql" {
+		return strings.ToLower(t.text)
+	}
+	return t.text
+}
+
+// columnTypeOf 读取列类型，如 VARCHAR(64)、DOUBLE PRECISION、INTEGER[]、BIGINT UNSIGNED
+func columnTypeOf(c *cursor) string {
+	var b strings.Builder
+	for !c.done() {
+		t := c.peek(0)
+		switch {
+		case t.is("("):
+			args, err := c.group()
+			if err != nil {
+				return b.String()
+			}
+			b.WriteString("(" + rawText(args) + ")")
+		case t.is("["):
+			for !c.done() && !c.next().is("]") {
+			}
+			b.WriteString("[]")
+		case t.kind == tokenWord:
+			if contains(typeEnd, strings.ToUpper(t.text)) || (t.is("CHARACTER") && c.peek(1).is("SET")) {
+				return b.String()
+			}
+			if b.Len() > 0 {
+				b.WriteString(" ")
+			}
+			b.WriteString(strings.ToUpper(t.text))
+			c.next()
+		default:
+			return b.String()
+		}
+	}
+	return b.String()
+}
+
+// expression 读取默认值表达式，字符串保留引号，去掉 Postgres 的类型转换，如 'a'::character varying
+func expression(c *cursor) string {
+	var (
+		text string
+		t    = c.peek(0)
+	)
+	switch {
+	case t.is("("):
+		args, _ := c.group()
+		text = "(" + rawText(args) + ")"
+	case t.is("-") || t.is("+"):
+		c.next()
+		text = t.text + c.next().text
+	case t.kind == tokenString:
+		c.next()
+		text = (&Generate{}).Quote(t.text)
+	case t.kind == tokenWord && c.peek(1).is("("):
+		c.next()
+		args, _ := c.group()
+		text = t.text + "(" + rawText(args) + ")"
+	default:
+		text = c.next().text
+	}
+	for c.peek(0).is(":") && c.peek(1).is(":") {
+		c.pos += 2
+		columnTypeOf(c)
+	}
+	return text
+}
+
+// rawText 将词法单元还原为 SQL 文本
+func rawText(tokens []ddlToken) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && t.kind != tokenSymbol && tokens[i-1].kind != tokenSymbol {
+			b.WriteString(" ")
+		}
+		switch t.kind {
+		case tokenString:
+			b.WriteString((&Generate{}).Quote(t.text))
+		case tokenIdent:
+			b.WriteString(`"` + t.text + `"`)
+		default:
+			b.WriteString(t.text)
+		}
+	}
+	return b.String()
+}
+
+// splitTokens 按最外层的逗号拆分词法单元
+func splitTokens(tokens []ddlToken) [][]ddlToken {
+	var (
+		depth int
+		start int
+		out   = make([][]ddlToken, 0)
+	)
+	for i, t := range tokens {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case t.is(",") && depth == 0:
+			out = append(out, tokens[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		out = append(out, tokens[start:])
+	}
+	return out
+}
+
+// findColumn 按名称查找列
+func findColumn(schema *Schema, name string) *Column {
+	if schema == nil {
+		return nil
+	}
+	for _, c := range schema.Columns {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
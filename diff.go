@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext 统一格式 diff 的上下文行数
+const diffContext = 3
+
+// diffLine 单行差异，Op 为 ' '、'-' 或 '+'
+type diffLine struct {
+	Op   byte
+	Text string
+	A, B int // 行在两个文件中的下标
+}
+
+// unifiedDiff 生成统一格式的 diff，内容相同时返回空字符串
+func unifiedDiff(oldName, newName string, old, new []byte) string {
+	var (
+		a     = splitLines(old)
+		b     = splitLines(new)
+		lines = diffLines(a, b)
+		buf   strings.Builder
+	)
+
+	changed := false
+	for _, l := range lines {
+		if l.Op != ' ' {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(lines); {
+		// 查找下一处修改
+		first := start
+		for first < len(lines) && lines[first].Op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+
+		// 向后扩展，间隔不超过两倍上下文的修改合并为一个 hunk
+		last := first
+		for i := first; i < len(lines); i++ {
+			if lines[i].Op != ' ' {
+				last = i
+			} else if i-last > 2*diffContext {
+				break
+			}
+		}
+
+		from := first - diffContext
+		if from < start {
+			from = start
+		}
+		if from < 0 {
+			from = 0
+		}
+		to := last + diffContext + 1
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		writeHunk(&buf, lines[from:to])
+		start = to
+	}
+	return buf.String()
+}
+
+// diffLines 根据最长公共子序列生成逐行差异
+func diffLines(a, b []string) []diffLine {
+	var (
+		i, j int
+		out  = make([]diffLine, 0, len(a)+len(b))
+	)
+	for _, p := range append(lcs(a, b), [2]int{len(a), len(b)}) {
+		for ; i < p[0]; i++ {
+			out = append(out, diffLine{Op: '-', Text: a[i], A: i, B: j})
+		}
+		for ; j < p[1]; j++ {
+			out = append(out, diffLine{Op: '+', Text: b[j], A: i, B: j})
+		}
+		if i < len(a) && j < len(b) {
+			out = append(out, diffLine{Op: ' ', Text: a[i], A: i, B: j})
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// writeHunk 写入单个 hunk
+func writeHunk(buf *strings.Builder, lines []diffLine) {
+	var (
+		startA = lines[0].A
+		startB = lines[0].B
+		countA int
+		countB int
+	)
+	for _, l := range lines {
+		if l.Op != '+' {
+			countA++
+		}
+		if l.Op != '-' {
+			countB++
+		}
+	}
+	// 按统一格式约定，行号从 1 开始，空范围的起始行号为前一行
+	if countA > 0 {
+		startA++
+	}
+	if countB > 0 {
+		startB++
+	}
+
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(startA, countA), hunkRange(startB, countB))
+	for _, l := range lines {
+		buf.WriteByte(l.Op)
+		buf.WriteString(l.Text)
+		if !strings.HasSuffix(l.Text, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange 格式化 hunk 的行范围
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
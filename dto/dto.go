@@ -2,10 +2,14 @@ package dto
 
 // *********************************************** 配置代码开始 ***********************************************
 // 文件名生成规则： 使用下面👇的 struct 名称做为前缀，加上对应的功能描述，如： instance_api.go
-// 此结构体为生成代码的根据，必须包含 ID 字段， 不支持 bool 类型
+// 此结构体为生成代码的根据，必须包含 ID 字段
 // parameter => 表示是否需要做为参数
 // required => 表示是否为必须的参数
-// time => 表示是否为时间字段
+// time => 表示是否为时间字段，time.Time 与 *time.Time 类型的字段无需标记
+// nested => 结构体字段的存储方式：json（默认，以 JSON 列存储）、flatten（展开为多个字段，列名加上 prefix）
+// rel => 与其他实体的关联：belongs_to:User（外键字段上）、has_many:Device、many_to_many:Role（关联实体的切片上），many_to_many 可指定中间表，如 many_to_many:User:user_roles
+// time_format => 时间字段在请求与回包中的格式：unix、millis、rfc3339，默认使用配置中的 time_format
+// db_type => 列类型，覆盖默认的类型映射，如 db_type:"VARCHAR(32)"
 
 var (
 	StructMap = map[string]interface{}{
@@ -17,7 +21,7 @@ var (
 type User struct {
 	Id            int64 `json:"id"`
 	Face          int   `json:"face" parameter:"true"`
-	Fingerprint   int   `json:"fingerprint"parameter:"true"`
+	Fingerprint   int   `json:"fingerprint" parameter:"true"`
 	Vibration     int   `json:"vibration" parameter:"true"`
 	CutPower      int   `json:"cut_power" parameter:"true"`
 	ChargeMonitor int   `json:"charge_monitor" parameter:"true"`
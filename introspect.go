@@ -0,0 +1,386 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
+
+// goTypes 列类型对应的 dto 字段类型，类型中的长度、精度等修饰会被忽略，UNSIGNED 的整数列使用无符号类型
+var goTypes = map[string]string{
+	"BIGINT":              "int64",
+	"INT8":                "int64",
+	"BIGSERIAL":           "int64",
+	"SERIAL8":             "int64",
+	"INTEGER":             "int32",
+	"INT":                 "int32",
+	"INT4":                "int32",
+	"MEDIUMINT":           "int32",
+	"SERIAL":              "int32",
+	"SERIAL4":             "int32",
+	"SMALLINT":            "int16",
+	"INT2":                "int16",
+	"SMALLSERIAL":         "int16",
+	"SERIAL2":             "int16",
+	"TINYINT":             "int8",
+	"REAL":                "float32",
+	"FLOAT":               "float32",
+	"FLOAT4":              "float32",
+	"DOUBLE":              "float64",
+	"DOUBLE PRECISION":    "float64",
+	"FLOAT8":              "float64",
+	"NUMERIC":             "decimal.Decimal",
+	"DECIMAL":             "decimal.Decimal",
+	"VARCHAR":             "string",
+	"CHARACTER VARYING":   "string",
+	"CHAR":                "string",
+	"CHARACTER":           "string",
+	"NVARCHAR":            "string",
+	"NCHAR":               "string",
+	"TEXT":                "string",
+	"TINYTEXT":            "string",
+	"MEDIUMTEXT":          "string",
+	"LONGTEXT":            "string",
+	"CITEXT":              "string",
+	"UUID":                "uuid.UUID",
+	"ENUM":                "string",
+	"BOOLEAN":             "bool",
+	"BOOL":                "bool",
+	"JSON":                "json.RawMessage",
+	"JSONB":               "json.RawMessage",
+	"BYTEA":               "[]byte",
+	"BLOB":                "[]byte",
+	"TINYBLOB":            "[]byte",
+	"MEDIUMBLOB":          "[]byte",
+	"LONGBLOB":            "[]byte",
+	"BINARY":              "[]byte",
+	"VARBINARY":           "[]byte",
+	"VARCHAR[]":           "pq.StringArray",
+	"CHARACTER VARYING[]": "pq.StringArray",
+	"TEXT[]":              "pq.StringArray",
+	"BIGINT[]":            "pq.Int64Array",
+	"INT8[]":              "pq.Int64Array",
+	"INTEGER[]":           "pq.Int64Array",
+	"INT4[]":              "pq.Int64Array",
+}
+
+// timeTypes 时间类型的列，dto 中使用 time.Time，可以为空的列使用 *time.Time
+var timeTypes = []string{
+	"TIMESTAMP", "TIMESTAMPTZ", "TIMESTAMP WITH TIME ZONE", "TIMESTAMP WITHOUT TIME ZONE", "DATETIME", "DATE",
+}
+
+// autoColumns 自动维护的时间列，不做为参数
+var autoColumns = []string{"created_at", "updated_at", "deleted_at"}
+
+// typeModifier 列类型中的长度、精度等修饰
+var typeModifier = regexp.MustCompile(`\([^)]*\)|\b(UNSIGNED|SIGNED|ZEROFILL)\b`)
+
+// goType 列类型对应的 dto 字段类型，ok 为 false 时表示不支持的类型
+func goType(columnType string) (typeName string, isTime, ok bool) {
+	name := strings.ToUpper(columnType)
+	// MySQL 中的 BOOLEAN 为 TINYINT(1) 的别名
+	if strings.Join(strings.Fields(name), "") == "TINYINT(1)" {
+		return "bool", false, true
+	}
+	unsigned := strings.Contains(name, "UNSIGNED")
+	name = strings.Join(strings.Fields(typeModifier.ReplaceAllString(name, "")), " ")
+	if strings.HasSuffix(name, " ARRAY") {
+		name = strings.TrimSuffix(name, " ARRAY") + "[]"
+	}
+	if contains(timeTypes, name) {
+		return "time.Time", true, true
+	}
+	typeName, ok = goTypes[name]
+	if unsigned && strings.HasPrefix(typeName, "int") {
+		typeName = "u" + typeName
+	}
+	return typeName, false, ok
+}
+
+// dtoFile introspect 生成的 dto 文件
+type dtoFile struct {
+	Package  string
+	Source   string // 表结构的来源，DDL 文件或数据库方言
+	Entities []*dtoEntity
+}
+
+// dtoEntity 表对应的 dto 结构体
+type dtoEntity struct {
+	*Generate
+	Table string
+	Notes []string // 需要手工处理的问题，如不支持的列类型
+}
+
+// Imports 所有结构体的字段类型引用的包
+func (d *dtoFile) Imports() []string {
+	out := make([]string, 0)
+	for _, e := range d.Entities {
+		for _, path := range e.TypeImports() {
+			if !contains(out, path) {
+				out = append(out, path)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// newDtoEntity 根据表结构构建 dto 结构体
+//   - 主键以外的列做为参数，created_at 等自动维护的时间列除外
+//   - 没有默认值的非空参数为必须的参数
+//   - 时间类型的列使用 time.Time，可以为空时使用 *time.Time
+//   - 列类型与类型映射中的列类型不同时，如 VARCHAR(32)，通过 db_type 保留
+func newDtoEntity(schema *Schema) *dtoEntity {
+	var (
+		name = singular(schema.Table)
+		e    = &dtoEntity{Generate: newGenerator("", Case2Camel(name)), Table: schema.Table, Notes: make([]string, 0)}
+	)
+	e.Comment, e.Dialect = schema.Comment, schema.Dialect
+	for _, c := range schema.Columns {
+		typeName, isTime, ok := goType(c.Type)
+		if !ok {
+			typeName = "string"
+			e.Notes = append(e.Notes, fmt.Sprintf("列 %s 的类型 %s 暂不支持，已转换为 string", c.Name, c.Type))
+		}
+		if c.Primary && strings.Contains(typeName, "int") {
+			// 生成的代码中主键统一使用 int64
+			typeName = "int64"
+		}
+		f := &Field{Name: Case2Camel(c.Name), Type: typeName, Json: c.Name, JsonTag: c.Name, Comment: c.Comment, Char: "`"}
+		if isTime && !c.NotNull && !c.Primary {
+			f.Type = "*" + typeName
+		}
+		// 与类型映射中的列类型不同时通过 db_type 保留原有的列类型
+		if t := e.ColumnType(f); !c.Primary && canonicalType(t) != canonicalType(c.Type) {
+			f.DBType = strings.Join(strings.Fields(strings.ToUpper(c.Type)), " ")
+		}
+		if c.Primary && c.Name != "id" {
+			e.Notes = append(e.Notes, fmt.Sprintf("主键 %s 不是 id，gen 只会处理包含 Id 字段的结构体", c.Name))
+		}
+		if !c.Primary && !contains(autoColumns, c.Name) {
+			f.Parameter = "true"
+			if c.NotNull && c.Default == "" {
+				f.Required = "true"
+			}
+		}
+		if ok && !c.Primary && !isTime {
+			f.Default = literal(c.Default)
+			// MySQL 中 bool 列的默认值为 0 或 1
+			if f.Type == "bool" {
+				switch strings.ToLower(f.Default) {
+				case "0", "false":
+					f.Default = "false"
+				case "1", "true":
+					f.Default = "true"
+				}
+			}
+		}
+		if c.Unique {
+			f.Unique = "true"
+		} else if c.Index {
+			f.Index = "true"
+		}
+		e.Fields = append(e.Fields, f)
+	}
+	if e.Table != e.Generate.Table() {
+		e.Notes = append(e.Notes, fmt.Sprintf("表名 %s 与生成代码中的表名 %s 不一致，需要覆盖 entity 模板中的 table_name", e.Table, e.Generate.Table()))
+	}
+	return e
+}
+
+// StructTag dto 字段的 tag
+func (f *Field) StructTag() string {
+	tags := []string{fmt.Sprintf(`json:"%s"`, f.Json)}
+	for _, tag := range [][2]string{
+		{"parameter", f.Parameter},
+		{"required", f.Required},
+		{"time", f.Time},
+		{"default", f.Default},
+		{"index", f.Index},
+		{"unique", f.Unique},
+		{"db_type", f.DBType},
+	} {
+		if tag[1] != "" {
+			tags = append(tags, fmt.Sprintf(`%s:"%s"`, tag[0], tag[1]))
+		}
+	}
+	return strings.Join(tags, " ")
+}
+
+// literal 将列的默认值转换为 dto 中 default tag 的值，字符串去掉引号，NULL 与函数调用等表达式忽略
+func literal(def string) string {
+	switch {
+	case def == "" || strings.EqualFold(def, "NULL") || strings.Contains(def, "("):
+		return ""
+	case strings.HasPrefix(def, "'") && strings.HasSuffix(def, "'") && len(def) > 1:
+		return strings.ReplaceAll(def[1:len(def)-1], "''", "'")
+	case strings.ContainsAny(def, `"`+"`"):
+		return ""
+	}
+	return def
+}
+
+// singular 表名对应的实体名称，去掉表名末尾的复数形式
+func singular(table string) string {
+	switch {
+	case strings.HasSuffix(table, "ies"):
+		return strings.TrimSuffix(table, "ies") + "y"
+	case strings.HasSuffix(table, "ss"):
+		return table
+	}
+	return strings.TrimSuffix(table, "s")
+}
+
+// querier 读取表结构使用的查询，由 *sql.DB 实现，测试中使用返回固定结果的驱动
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// loadDatabase 通过 database/sql 读取数据库中的表结构，驱动名称与方言相同
+func loadDatabase(dialect, dsn string) ([]*Schema, error) {
+	db, err := sql.Open(dialect, dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if dialect == "mysql" {
+		return loadMySQL(db)
+	}
+	return loadPostgres(db)
+}
+
+// loadPostgres 读取 Postgres 当前 schema 中的表结构
+func loadPostgres(db querier) ([]*Schema, error) {
+	const columns = `
+SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull,
+       COALESCE(pg_get_expr(d.adbin, d.adrelid), ''),
+       COALESCE(col_description(c.oid, a.attnum), ''),
+       COALESCE(obj_description(c.oid, 'pg_class'), '')
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+JOIN pg_attribute a ON a.attrelid = c.oid
+LEFT JOIN pg_attrdef d ON d.adrelid = c.oid AND d.adnum = a.attnum
+WHERE c.relkind IN ('r', 'p') AND n.nspname = current_schema() AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY c.relname, a.attnum`
+	const indexes = `
+SELECT t.relname, a.attname, i.indisprimary, i.indisunique
+FROM pg_index i
+JOIN pg_class t ON t.oid = i.indrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = i.indkey[0]
+WHERE n.nspname = current_schema() AND i.indnatts = 1 AND i.indexprs IS NULL AND i.indpred IS NULL`
+
+	list, tables, err := queryColumns(db, "postgres", columns, func(rows *sql.Rows, table, comment *string, c *Column) error {
+		var def string
+		if err := rows.Scan(table, &c.Name, &c.Type, &c.NotNull, &def, &c.Comment, comment); err != nil {
+			return err
+		}
+		// 默认值为 'a'::character varying 这样的表达式，与 DDL 使用相同的解析方式
+		tokens, err := lexDDL(def, false)
+		if err != nil {
+			return err
+		}
+		if len(tokens) > 0 {
+			c.Default = expression(&cursor{tokens: tokens})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, queryIndexes(db, tables, indexes)
+}
+
+// loadMySQL 读取 MySQL 当前数据库中的表结构
+func loadMySQL(db querier) ([]*Schema, error) {
+	const columns = `
+SELECT c.TABLE_NAME, c.COLUMN_NAME, c.COLUMN_TYPE, c.IS_NULLABLE = 'NO', c.COLUMN_DEFAULT, c.COLUMN_COMMENT, t.TABLE_COMMENT
+FROM information_schema.COLUMNS c
+JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME
+WHERE c.TABLE_SCHEMA = DATABASE() AND t.TABLE_TYPE = 'BASE TABLE'
+ORDER BY c.TABLE_NAME, c.ORDINAL_POSITION`
+	const indexes = `
+SELECT TABLE_NAME, MIN(COLUMN_NAME), INDEX_NAME = 'PRIMARY', MIN(NON_UNIQUE) = 0
+FROM information_schema.STATISTICS
+WHERE TABLE_SCHEMA = DATABASE() AND SUB_PART IS NULL
+GROUP BY TABLE_NAME, INDEX_NAME
+HAVING COUNT(*) = 1`
+
+	list, tables, err := queryColumns(db, "mysql", columns, func(rows *sql.Rows, table, comment *string, c *Column) error {
+		var def sql.NullString
+		if err := rows.Scan(table, &c.Name, &c.Type, &c.NotNull, &def, &c.Comment, comment); err != nil {
+			return err
+		}
+		// MySQL 8 返回的字符串默认值不带引号
+		c.Default = def.String
+		if typeName, _, _ := goType(c.Type); def.Valid && typeName == "string" && !strings.HasPrefix(c.Default, "'") {
+			c.Default = (&Generate{}).Quote(c.Default)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, queryIndexes(db, tables, indexes)
+}
+
+// queryColumns 查询所有列并按表分组，scan 读取单行中的表名、表注释与列
+func queryColumns(db querier, dialect, query string, scan func(rows *sql.Rows, table, comment *string, c *Column) error) ([]*Schema, map[string]*Schema, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var (
+		list   = make([]*Schema, 0)
+		tables = make(map[string]*Schema)
+	)
+	for rows.Next() {
+		var (
+			table   string
+			comment string
+			c       = &Column{}
+		)
+		if err = scan(rows, &table, &comment, c); err != nil {
+			return nil, nil, err
+		}
+		schema, ok := tables[table]
+		if !ok {
+			schema = &Schema{Dialect: dialect, Table: table, Comment: comment, Columns: make([]*Column, 0)}
+			tables[table] = schema
+			list = append(list, schema)
+		}
+		schema.Columns = append(schema.Columns, c)
+	}
+	return list, tables, rows.Err()
+}
+
+// queryIndexes 查询单列的主键、唯一索引与普通索引
+func queryIndexes(db querier, tables map[string]*Schema, query string) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			table   string
+			column  string
+			primary bool
+			unique  bool
+		)
+		if err = rows.Scan(&table, &column, &primary, &unique); err != nil {
+			return err
+		}
+		markIndex(findColumn(tables[table], column), primary, unique)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// loadSource 解析 Go 源文件、目录或包路径中的结构体以及实体描述文件，构建生成模型
+func loadSource(projectName, path string) ([]*Generate, error) {
+	var (
+		err   error
+		files []string
+		fset  = token.NewFileSet()
+		list  = make([]*Generate, 0)
+	)
+
+	if files, err = sourceFiles(path); err != nil {
+		return nil, err
+	}
+
+	var (
+		specs  = make([]string, 0)
+		parsed = make([]*ast.File, 0, len(files))
+		pkg    = &packageStructs{fset: fset, types: make(map[string]*ast.StructType), embedded: make(map[string]bool), objects: make(map[string]bool)}
+	)
+	for _, filename := range files {
+		var file *ast.File
+		if isSpec(filename) {
+			specs = append(specs, filename)
+			continue
+		}
+		if file, err = parser.ParseFile(fset, filename, nil, parser.ParseComments); err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, file)
+		pkg.index(file)
+	}
+	for _, file := range parsed {
+		list = append(list, parseStructs(projectName, pkg, file)...)
+	}
+	// 被嵌入的结构体（如公共的 BaseModel）以及做为字段类型且没有 Id 的值对象不单独做为实体，与 dto.StructMap 一致
+	out := make([]*Generate, 0, len(list))
+	for _, generator := range list {
+		name := generator.TitleName
+		if !pkg.embedded[name] && !(pkg.objects[name] && !generator.HasID()) {
+			out = append(out, generator)
+		}
+	}
+	list = out
+	if len(specs) == 0 {
+		return list, nil
+	}
+	generators, err := loadSpecs(projectName, specs)
+	if err != nil {
+		return nil, err
+	}
+	return append(list, generators...), nil
+}
+
+// loadDDL 解析 SQL 文件中的 CREATE TABLE 语句构建生成模型，列类型与 introspect 使用相同的规则转换为字段类型
+// 生成的代码沿用 DDL 中的表名，存在不支持的列类型时报错
+func loadDDL(projectName, path, dialect string) ([]*Generate, error) {
+	var (
+		err     error
+		src     []byte
+		schemas []*Schema
+		list    = make([]*Generate, 0)
+	)
+	if src, err = os.ReadFile(path); err != nil {
+		return nil, err
+	}
+	if schemas, err = parseDDL(src, dialect); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, schema := range schemas {
+		for _, c := range schema.Columns {
+			if _, _, ok := goType(c.Type); !ok {
+				return nil, fmt.Errorf("%s: table %s: column %s has unsupported type %q", path, schema.Table, c.Name, c.Type)
+			}
+		}
+		generator := newDtoEntity(schema).Generate
+		generator.ProjectName, generator.TableName = projectName, schema.Table
+		list = append(list, generator)
+	}
+	return list, nil
+}
+
+// sourceFiles 将输入路径解析为需要读取的 go 文件与实体描述文件列表
+// 支持单个文件、目录以及可被 go/build 定位的包路径
+func sourceFiles(path string) ([]string, error) {
+	var (
+		err   error
+		info  os.FileInfo
+		dir   = path
+		files []string
+	)
+
+	if info, err = os.Stat(path); err == nil && !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	if err != nil {
+		var pkg *build.Package
+		if pkg, err = build.Import(path, ".", build.FindOnly); err != nil {
+			return nil, fmt.Errorf("load %s: %w", path, err)
+		}
+		dir = pkg.Dir
+	}
+
+	if files, err = filepath.Glob(filepath.Join(dir, "*.go")); err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0, len(files))
+	for _, f := range files {
+		if !strings.HasSuffix(f, "_test.go") {
+			out = append(out, f)
+		}
+	}
+	sort.Strings(out)
+	if files, err = specFiles(dir); err != nil {
+		return nil, err
+	}
+	if out = append(out, files...); len(out) == 0 {
+		return nil, fmt.Errorf("load %s: no go files or entity files found", path)
+	}
+	return out, nil
+}
+
+// packageStructs 包中定义的结构体，用于展开匿名结构体与 nested:"flatten" 的结构体
+type packageStructs struct {
+	fset     *token.FileSet
+	types    map[string]*ast.StructType
+	embedded map[string]bool // 被其他结构体嵌入的结构体
+	objects  map[string]bool // 做为其他结构体字段类型的结构体
+}
+
+// index 记录文件中定义的结构体，包括未导出的结构体
+func (p *packageStructs) index(file *ast.File) {
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					p.types[ts.Name.Name] = st
+				}
+			}
+		}
+	}
+}
+
+// lookup 字段类型对应的包中的结构体，指针类型使用其指向的结构体
+func (p *packageStructs) lookup(expr ast.Expr) (string, *ast.StructType) {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		if st, ok := p.types[ident.Name]; ok {
+			return ident.Name, st
+		}
+	}
+	return "", nil
+}
+
+// parseStructs 提取文件中所有导出的结构体定义
+func parseStructs(projectName string, pkg *packageStructs, file *ast.File) []*Generate {
+	list := make([]*Generate, 0)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok || !ts.Name.IsExported() {
+				continue
+			}
+
+			doc := ts.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+
+			generator := newGenerator(projectName, ts.Name.Name)
+			generator.Comment = trimComment(ts.Name.Name, doc)
+			generator.Pos = position(pkg.fset, ts.Pos())
+			generator.Fields = pkg.fields(st, map[string]bool{ts.Name.Name: true})
+			list = append(list, generator)
+		}
+	}
+	return list
+}
+
+// fields 将结构体字段转换为字段模型，规则与反射一致，seen 为展开路径上的结构体，避免循环引用
+func (p *packageStructs) fields(st *ast.StructType, seen map[string]bool) []*Field {
+	fields := make([]*Field, 0)
+	for _, a := range st.Fields.List {
+		var (
+			tag         reflect.StructTag
+			typeName    = typeString(a.Type)
+			names       = make([]string, 0, len(a.Names))
+			object, sub = p.lookup(a.Type)
+		)
+
+		if a.Tag != nil {
+			if v, err := strconv.Unquote(a.Tag.Value); err == nil {
+				tag = reflect.StructTag(v)
+			}
+		}
+		if seen[object] {
+			object, sub = "", nil
+		}
+		switch {
+		case object != "" && len(a.Names) == 0:
+			p.embedded[object] = true
+		case object != "":
+			p.objects[object] = true
+		}
+		// 没有 json 名称的匿名结构体展开为外层的字段
+		if len(a.Names) == 0 && sub != nil && jsonName(tag) == "" {
+			seen[object] = true
+			fields = append(fields, p.fields(sub, seen)...)
+			delete(seen, object)
+			continue
+		}
+
+		for _, n := range a.Names {
+			names = append(names, n.Name)
+		}
+		// 匿名字段与反射保持一致，使用类型名作为字段名
+		if len(names) == 0 {
+			names = append(names, embeddedName(a.Type))
+		}
+
+		for _, name := range names {
+			if !ast.IsExported(name) {
+				continue
+			}
+			field := newField(name, typeName, tag)
+			comment := a.Doc
+			if comment == nil {
+				comment = a.Comment
+			}
+			field.Comment = trimComment(name, comment)
+			field.Pos = position(p.fset, a.Pos())
+			if sub != nil && field.Nested == "flatten" {
+				seen[object] = true
+				fields = append(fields, flatten(field, p.fields(sub, seen))...)
+				delete(seen, object)
+				continue
+			}
+			field.Object = sub != nil
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// position 返回 file:line 形式的位置
+func position(fset *token.FileSet, pos token.Pos) string {
+	p := fset.Position(pos)
+	return fmt.Sprintf("%s:%d", p.Filename, p.Line)
+}
+
+// typeString 返回模板中使用的类型名称
+// po 包下的类型与反射保持一致只保留类型名，模板中会自行补全 po. 前缀
+func typeString(expr ast.Expr) string {
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "po" {
+			return sel.Sel.Name
+		}
+	}
+	return types.ExprString(expr)
+}
+
+// embeddedName 获取匿名字段的字段名
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return types.ExprString(expr)
+}
+
+// trimComment 提取注释文本，并去掉以名称开头的惯用前缀
+func trimComment(name string, doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	text := strings.Join(strings.Fields(doc.Text()), " ")
+	if strings.HasPrefix(text, name+" ") {
+		text = strings.TrimPrefix(text, name+" ")
+	}
+	return text
+}
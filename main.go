@@ -2,100 +2,302 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"go/format"
-	"html/template"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
-	"sync"
+	"text/template"
 	"unicode"
-
-	"generator/dto"
 )
 
-// *********************************************** 配置代码开始 ***********************************************
-// 文件名生成规则： 使用下面👇的 struct 名称做为前缀，加上对应的功能描述，如： instance_api.go
-// 此结构体为生成代码的根据，必须包含 ID 字段， 不支持 bool 类型
+// 文件名生成规则： 使用 dto 中的 struct 名称做为前缀，加上对应的功能描述，如： instance_api.go
+// 此结构体为生成代码的根据，必须包含 ID 字段
 // parameter => 表示是否需要做为参数
 // required => 表示是否为必须的参数
 // time => 表示是否为时间字段
+// nested => 结构体字段的存储方式：json（默认，以 JSON 列存储）、flatten（展开为多个字段，列名加上 prefix）
+// rel => 与其他实体的关联：belongs_to:User（外键字段上）、has_many:Device、many_to_many:Role（关联实体的切片上）
+// time_format => 时间字段在请求与回包中的格式：unix、millis、rfc3339，默认使用配置中的 time_format
+// db_type => 列类型，覆盖默认的类型映射，如 db_type:"VARCHAR(32)"
 
-const (
-	// ProjectName 项目名称
-	ProjectName = "manager"
-)
-
-// *********************************************** 配置代码结束 ***********************************************
-
-// *********************************************** 以下代码请不要随便更改 ***********************************************
 func main() {
-	// instance 根据上面定义的结构体修改
-	for _, v := range dto.StructMap {
-		generate(ProjectName, v)
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "generator: %s\n", err)
+		os.Exit(exitCode(err))
 	}
-	log.Println("Finish all")
 }
 
-func generate(projectName string, instance interface{}) {
-	var (
-		err       error
-		generator = &Generate{ProjectName: projectName}
-		t         = reflect.TypeOf(instance)
-		v         = reflect.ValueOf(instance)
-		fields    = make([]*Field, 0)
-		src       []byte
-		f         *os.File
-	)
+// exitCode 错误对应的退出状态，CI 中用于区分需要更新、需要手工合并与生成器出错
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errOutdated) || errors.Is(err, errInvalid):
+		return 1
+	case errors.Is(err, errConflict):
+		return 3
+	}
+	return 2
+}
+
+// newGenerate 通过反射 dto 实例构建生成模型
+func newGenerate(projectName string, instance interface{}) (*Generate, error) {
+	t := reflect.TypeOf(instance)
 	if t.Kind() != reflect.Struct {
-		log.Printf("is not a valid Instance struct, please use Instance struct instead \n")
+		return nil, fmt.Errorf("%s is not a valid Instance struct, please use Instance struct instead", t)
+	}
+
+	generator := newGenerator(projectName, t.Name())
+	generator.Fields = reflectFields(t, map[reflect.Type]bool{})
+	return generator, nil
+}
+
+// reflectFields 通过反射将结构体字段转换为字段模型，匿名结构体与 nested:"flatten" 的结构体展开为多个字段
+// 与 dto 位于同一个包中的结构体为值对象，seen 为展开路径上的结构体，避免循环引用
+func reflectFields(t reflect.Type, seen map[reflect.Type]bool) []*Field {
+	var fields = make([]*Field, 0, t.NumField())
+	seen[t] = true
+	defer delete(seen, t)
+	for i := 0; i < t.NumField(); i++ {
+		var (
+			a      = t.Field(i)
+			st     = a.Type
+			object bool
+		)
+		if st.Kind() == reflect.Ptr {
+			st = st.Elem()
+		}
+		object = st.Kind() == reflect.Struct && st.PkgPath() == t.PkgPath() && !seen[st]
+		if a.Anonymous && object && jsonName(a.Tag) == "" {
+			fields = append(fields, reflectFields(st, seen)...)
+			continue
+		}
+		if !a.IsExported() {
+			continue
+		}
+		name := a.Name
+		if a.Anonymous {
+			name = st.Name()
+		}
+		f := newField(name, reflectType(a.Type, t.PkgPath()), a.Tag)
+		if object && f.Nested == "flatten" {
+			fields = append(fields, flatten(f, reflectFields(st, seen))...)
+			continue
+		}
+		f.Object = object
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// reflectType 返回模板中使用的类型名称，与解析源码时保持一致：dto 包与 po 包中的类型只保留类型名
+func reflectType(t reflect.Type, pkg string) string {
+	if t.Name() != "" {
+		if t.PkgPath() == "" || t.PkgPath() == pkg || path.Base(t.PkgPath()) == "po" {
+			return t.Name()
+		}
+		return t.String()
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + reflectType(t.Elem(), pkg)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "[]byte"
+		}
+		return "[]" + reflectType(t.Elem(), pkg)
+	case reflect.Map:
+		return "map[" + reflectType(t.Key(), pkg) + "]" + reflectType(t.Elem(), pkg)
 	}
+	return t.String()
+}
 
-	generator.TitleName = t.Name()
-	generator.FileName = Camel2Case(t.Name())
-	generator.Char = "`"
-	generator.Name = LeftToLower(t.Name())
+// jsonName tag 中的 json 名称，不包含 omitempty 等选项
+func jsonName(tag reflect.StructTag) string {
+	return strings.Split(tag.Get("json"), ",")[0]
+}
 
-	for i := 0; i < v.NumField(); i++ {
-		var a = t.Field(i)
-		typeName := a.Type.Name()
-		if a.Type.Kind() == reflect.Slice {
-			typeName = a.Type.String()
+// flatten 将 nested:"flatten" 的结构体字段展开到外层
+// 字段名加上外层的字段名，json 名称与列名加上 prefix，未指定时为外层的 json 名称加上 _
+// 外层的 parameter、required 应用到没有设置这两个 tag 的字段上
+func flatten(outer *Field, fields []*Field) []*Field {
+	prefix, ok := reflect.StructTag(outer.Tag).Lookup("prefix")
+	if !ok {
+		prefix = outer.JsonName() + "_"
+	}
+	for _, f := range fields {
+		f.Name = outer.Name + f.Name
+		if name := strings.Split(f.Json, ",")[0]; name != "" && name != "-" {
+			f.Json = prefix + f.Json
+			f.JsonTag = prefix + f.JsonTag
+		}
+		if f.Parameter == "" {
+			f.Parameter = outer.Parameter
+		}
+		if f.Required == "" {
+			f.Required = outer.Required
 		}
-		field := &Field{
-			Name:      a.Name,
-			Type:      typeName,
-			Json:      a.Tag.Get("json"),
-			Time:      a.Tag.Get("time"),
-			Required:  a.Tag.Get("required"),
-			Parameter: a.Tag.Get("parameter"),
-			JsonTag:   a.Tag.Get("json"),
-			Char:      "`",
+	}
+	return fields
+}
+
+// newGenerator 根据结构体名称初始化生成模型
+func newGenerator(projectName, name string) *Generate {
+	return &Generate{
+		ProjectName: projectName,
+		TitleName:   name,
+		FileName:    Camel2Case(name),
+		Char:        "`",
+		Name:        LeftToLower(name),
+	}
+}
+
+// newField 根据字段名称、类型与 tag 构建字段模型
+func newField(name, typeName string, tag reflect.StructTag) *Field {
+	return &Field{
+		Name:       name,
+		Type:       typeName,
+		Json:       tag.Get("json"),
+		Time:       tag.Get("time"),
+		Required:   tag.Get("required"),
+		Parameter:  tag.Get("parameter"),
+		JsonTag:    tag.Get("json"),
+		Validate:   tag.Get("validate"),
+		Default:    tag.Get("default"),
+		Index:      tag.Get("index"),
+		Unique:     tag.Get("unique"),
+		DBType:     tag.Get("db_type"),
+		TimeFormat: tag.Get("time_format"),
+		Nested:     tag.Get("nested"),
+		Rel:        tag.Get("rel"),
+		Proto:      tag.Get("proto"),
+		Tag:        string(tag),
+		Char:       "`",
+	}
+}
+
+// output 单个生成文件
+type output struct {
+	Layer    string
+	Path     string
+	Baseline string // 上次生成的原始内容存放位置，共用文件为空
+	Src      []byte
+	// Merge 文件已存在时与已有内容合并，为空时与上次生成的原始内容做三方合并
+	Merge func(old []byte) ([]byte, error)
+}
+
+// render 按层渲染生成模型，返回待写入的文件
+func render(root string, generator *Generate, layers []*layer) ([]*output, error) {
+	var list = make([]*output, 0, len(layers))
+	for _, l := range layers {
+		var (
+			err   error
+			files []*output
+		)
+		if l.Versioned {
+			files, err = renderMigrations(root, generator, l)
+		} else {
+			files, err = renderLayer(root, generator, l)
+		}
+		if err != nil {
+			return nil, err
 		}
-		fields = append(fields, field)
+		list = append(list, files...)
 	}
-	generator.Fields = fields
+	return list, nil
+}
 
-	for k, val := range m {
-		var filename = fmt.Sprintf("../%s%s.%s", addr[k], generator.FileName, "go")
-		if src, err = parse(val, generator); err != nil {
-			log.Printf("generate %s error: %s", filename, err)
+// renderLayer 渲染单个层，分为多个部分的层每个部分生成一个文件
+func renderLayer(root string, generator *Generate, l *layer) ([]*output, error) {
+	var (
+		err  error
+		src  []byte
+		list = make([]*output, 0, 1)
+	)
+	for _, part := range l.parts() {
+		var (
+			filename = layerPath(root, l, generator, part)
+			p        = l.Template
+		)
+		if part != "" {
+			p = l.Template.Lookup(part)
+		}
+		if src, err = execute(p, generator); err != nil {
+			return nil, fmt.Errorf("generate %s error: %w", filename, err)
+		}
+		if src, err = formatSource(filename, src); err != nil {
+			return nil, fmt.Errorf("generate %s error: %w", filename, err)
 		}
+		out := &output{Layer: l.Name, Path: filename, Src: src}
+		if l.File == "" {
+			out.Baseline = baselinePath(root, l, generator, part)
+		} else {
+			out.Merge = mergeWith(src)
+		}
+		list = append(list, out)
+	}
+	return list, nil
+}
 
-		if !fileExists(filename) {
-			if f, err = os.Create(filename); err != nil {
-				log.Fatal(err)
-			}
-			if _, err = f.Write(src); err != nil {
-				log.Fatal(err)
-			}
-			f.Close()
+// combine 将多个实体共用文件的内容合并为一个输出，其余输出保持顺序不变
+func combine(list []*output) ([]*output, error) {
+	var (
+		err    error
+		out    = make([]*output, 0, len(list))
+		shared = make(map[string]*output)
+	)
+	for _, o := range list {
+		if o.Merge == nil {
+			out = append(out, o)
+			continue
+		}
+		prev, ok := shared[o.Path]
+		if !ok {
+			shared[o.Path] = o
+			out = append(out, o)
+			continue
 		}
+		if prev.Src, err = mergeOpenAPI(prev.Src, o.Src); err != nil {
+			return nil, fmt.Errorf("generate %s error: %w", o.Path, err)
+		}
+		prev.Merge = mergeWith(prev.Src)
+	}
+	return out, nil
+}
+
+// mergeWith 返回将 src 合并到已有文档的函数
+func mergeWith(src []byte) func(old []byte) ([]byte, error) {
+	return func(old []byte) ([]byte, error) {
+		return mergeOpenAPI(old, src)
 	}
 }
 
+// layerPath 返回实体在指定层的文件路径，part 为 up、down 等分开生成的部分
+func layerPath(root string, l *layer, generator *Generate, part string) string {
+	ext := l.ext()
+	if part != "" {
+		ext = "." + part + ext
+	}
+	switch {
+	case l.File != "":
+		return filepath.Join(root, l.Path, l.File)
+	case l.Versioned:
+		return migrationPath(filepath.Join(root, l.Path), generator, ext)
+	}
+	return filepath.Join(root, l.Path, generator.FileName+ext)
+}
+
+// baselinePath 返回实体在指定层上次生成结果的存放路径
+func baselinePath(root string, l *layer, generator *Generate, part string) string {
+	return filepath.Join(root, stateDir, "baseline", l.Path, filepath.Base(layerPath(root, l, generator, part)))
+}
+
 func fileExists(filename string) bool {
 	_, err := os.Stat(filename)
 	return !os.IsNotExist(err)
@@ -106,814 +308,610 @@ type Generate struct {
 	TitleName   string
 	Name        string
 	FileName    string
+	TableName   string // 表名，为空时为 FileName 加上 s
 	Char        string
+	Comment     string            // 结构体注释，仅在解析源码时存在
+	Pos         string            // 定义所在的位置 file:line，仅在解析源码与描述文件时存在
+	Framework   string            // api 层使用的框架
+	Route       string            // 路由风格：rpc、rest
+	Dialect     string            // 数据库方言：postgres、mysql
+	Version     string            // 新建迁移文件的版本号
+	Destructive bool              // 是否允许生成删除列、修改列类型等破坏性的迁移
+	Changes     []*Change         // 与上次生成的表结构相比的变更，为空时生成建表语句
+	TimeFormat  string            // 时间字段在请求与回包中的默认格式
+	Types       map[string]string // 配置文件中当前方言的自定义类型对应的列类型
+	Packages    map[string]string // 配置文件中自定义类型所在包的 import 路径
 	Fields      []*Field
+	Relations   []*Relation // 与其他实体的关联，加载全部实体后解析
 }
 
-type Field struct {
-	Name      string
-	Type      string
-	Json      string
-	Required  string
-	Parameter string
-	JsonTag   string
-	Time      string
-	Char      string
+// IsREST 是否使用 RESTful 路由风格
+func (g *Generate) IsREST() bool {
+	return g.Route == "rest"
 }
 
-// addr 存储位置
-var addr = map[string]string{
-	"api":      "/server/web/v1/", // 接口存储位置
-	"model":    "/model/",         // model 生成文件存储位置
-	"entity":   "/model/entity/",
-	"postgres": "/store/postgres/",
-	"store":    "/store/",
-	"bll":      "/bll/",
+// Resource RESTful 路由中的资源名称，如 charge_monitor => charge-monitors
+func (g *Generate) Resource() string {
+	return strings.ReplaceAll(g.FileName, "_", "-") + "s"
 }
 
-var m = map[string]string{
-	"api":      apiTemplate,
-	"model":    modelTemplate,
-	"bll":      bllTemplate,
-	"store":    interfaceTemplate,
-	"postgres": storeTemplate,
-	"entity":   entityTemplate,
+// PathTag 路径参数 id 的绑定 tag，chi 与 net/http 在 handler 中手动解析
+func (g *Generate) PathTag() string {
+	switch g.Framework {
+	case "", "gin":
+		return ` uri:"id"`
+	case "echo":
+		return ` param:"id"`
+	}
+	return ""
 }
 
-var (
-	importExistMap = map[string]struct{}{}
-	lock           sync.RWMutex
-)
-
-func importNotExist(strType string) bool {
-	lock.Lock()
-	defer lock.Unlock()
-	var ok bool
-	if _, ok = importExistMap[strType]; ok {
-		return false
+// QueryTag 查询参数的绑定 tag
+func (g *Generate) QueryTag(name string) string {
+	if g.Framework == "echo" {
+		return fmt.Sprintf(` query:"%s"`, name)
 	}
+	return fmt.Sprintf(` form:"%s"`, name)
+}
 
-	importExistMap[strType] = struct{}{}
-	return true
+// IsID 是否为主键字段
+func (f *Field) IsID() bool {
+	return f.Name == "Id"
 }
 
-func formatParams(params ...string) (ret string) {
-	for i := 0; i < len(params); i++ {
-		ret = fmt.Sprintf("%v/%v", ret, params[i])
-	}
-	return
+// IsParameter 是否做为参数
+func (f *Field) IsParameter() bool {
+	return f.Parameter == "true"
 }
 
-func parse(temp string, generator *Generate) ([]byte, error) {
-	var (
-		tmpl = template.New("")
-		err  error
-		p    *template.Template
-		buf  = bytes.NewBuffer([]byte{})
-		src  []byte
-	)
-	if p, err = tmpl.Funcs(template.FuncMap{
-		"notExist": importNotExist,
-		"format":   formatParams,
-	}).Parse(temp); err != nil {
-		return nil, err
-	}
+// IsRequired 是否为必须的参数
+func (f *Field) IsRequired() bool {
+	return f.Required == "true"
+}
 
-	if err = p.Execute(buf, generator); err != nil {
-		return nil, err
-	}
-	newStr := strings.Replace(buf.String(), "|| {", "{", -1)
-	if src, err = format.Source([]byte(newStr)); err != nil {
-		return nil, err
-	}
-	return src, nil
+// IsFilter 是否做为 store 中的查询条件，非必须的参数与外键均可查询，以 JSON 存储的值对象除外
+func (f *Field) IsFilter() bool {
+	return (f.IsParameter() && !f.IsRequired() || f.IsForeignKey()) && !f.Object
 }
 
-func Camel2Case(name string) string {
-	buffer := NewBuffer()
-	for i, r := range name {
-		if unicode.IsUpper(r) {
-			if i != 0 {
-				buffer.Append('_')
-			}
-			buffer.Append(unicode.ToLower(r))
-		} else {
-			buffer.Append(r)
+// ValidateTag 请求参数的 validate tag，合并 required 与 dto 中的 validate 规则
+// 非必须的参数加上 omitempty，未传递时跳过校验
+// bool 参数的 false 会被 required 视为未传递，不加 required，未传递时为 false
+func (f *Field) ValidateTag() string {
+	rules := make([]string, 0)
+	if f.IsRequired() && !f.IsBool() {
+		rules = append(rules, "required")
+	}
+	for _, rule := range splitList(f.Validate) {
+		if rule != "required" && rule != "omitempty" {
+			rules = append(rules, rule)
 		}
 	}
-	return buffer.String()
+	if len(rules) == 0 {
+		return ""
+	}
+	if !f.IsRequired() || f.IsBool() {
+		rules = append([]string{"omitempty"}, rules...)
+	}
+	return fmt.Sprintf(` validate:"%s"`, strings.Join(rules, ","))
 }
 
-func LeftToLower(s string) string {
-	if len(s) > 0 {
-		return strings.ToLower(string(s[0])) + s[1:]
-	}
-	return s
+// IsBool 是否为 bool 字段
+func (f *Field) IsBool() bool {
+	return f.Type == "bool"
 }
 
-func Ucfirst(str string) string {
-	for i, v := range str {
-		return string(unicode.ToUpper(v)) + str[i+1:]
+// ZeroValue 字段在 entity 中的零值，用于构建 entity 时填充不做为参数的字段
+func (f *Field) ZeroValue() string {
+	t := f.EntityType()
+	switch {
+	case t == "string" || t == "text":
+		return `""`
+	case t == "bool":
+		return "false"
+	case contains(numericTypes, t):
+		return "0"
+	case strings.HasPrefix(t, "*") || strings.HasPrefix(t, "[]") || strings.HasPrefix(t, "map[") ||
+		t == "json.RawMessage" || t == "pq.StringArray" || t == "pq.Int64Array":
+		return "nil"
+	case strings.HasPrefix(t, "po.") || t == "time.Time" || t == "decimal.Decimal" || t == "uuid.UUID":
+		return t + "{}"
 	}
-	return ""
+	// 自定义类型的底层类型未知
+	return "*new(" + t + ")"
 }
 
-func Lcfirst(str string) string {
-	for i, v := range str {
-		return string(unicode.ToLower(v)) + str[i+1:]
-	}
-	return ""
+// numericTypes 数值类型，零值为 0
+var numericTypes = []string{
+	"int", "int8", "int16", "int32", "int64", "uint", "uint8", "byte", "uint16", "uint32", "uint64", "float32", "float64",
 }
 
-type Buffer struct {
-	*bytes.Buffer
+// timeFormats 时间字段在请求与回包中的格式：unix 秒、unix 毫秒、RFC3339 字符串
+var timeFormats = []string{"unix", "millis", "rfc3339"}
+
+// IsTime 是否为时间字段，time.Time 类型的字段与标记了 time 的 int64 字段
+func (f *Field) IsTime() bool {
+	return f.Time == "true" || strings.TrimPrefix(f.Type, "*") == "time.Time"
 }
 
-func NewBuffer() *Buffer {
-	return &Buffer{Buffer: new(bytes.Buffer)}
+// IsNullable 字段是否可以为空，dto 中为指针类型
+func (f *Field) IsNullable() bool {
+	return strings.HasPrefix(f.Type, "*")
 }
 
-func (b *Buffer) Append(i interface{}) *Buffer {
-	switch val := i.(type) {
-	case int:
-		b.append(strconv.Itoa(val))
-	case int64:
-		b.append(strconv.FormatInt(val, 10))
-	case uint:
-		b.append(strconv.FormatUint(uint64(val), 10))
-	case uint64:
-		b.append(strconv.FormatUint(val, 10))
-	case string:
-		b.append(val)
-	case []byte:
-		b.Write(val)
-	case rune:
-		b.WriteRune(val)
+// timeFormat 时间字段的格式，未指定时为 unix
+func (f *Field) timeFormat() string {
+	if f.TimeFormat == "" {
+		return "unix"
 	}
-	return b
+	return f.TimeFormat
 }
 
-func (b *Buffer) append(s string) *Buffer {
-	defer func() {
-		if err := recover(); err != nil {
-			log.Println("*****内存不够了！******")
+// GoType 字段在请求与回包中的类型，时间字段按格式使用 int64 或 time.Time
+func (f *Field) GoType() string {
+	if f.IsTime() {
+		t := "int64"
+		if f.timeFormat() == "rfc3339" {
+			t = "time.Time"
 		}
-	}()
-	b.WriteString(s)
-	return b
-}
-
-var apiTemplate = `
-package v1
-
-import (
-	"github.com/gin-gonic/gin"
-	"{{.ProjectName}}/bll"
-	"{{.ProjectName}}/model"
-	"{{.ProjectName}}/server/web/middleware"
-	"{{.ProjectName}}/utils"
-)
-
-var {{.TitleName}} = &{{.Name}}{}
-
-func init() {
-	// 注册路由
-	RegisterRouter({{.TitleName}})
+		if f.IsNullable() {
+			return "*" + t
+		}
+		return t
+	}
+	return f.qualified()
 }
 
-
-type {{.Name}} struct {}
-
-// Init 初始化路由
-func (a *{{.Name}}) Init (r *gin.RouterGroup) {
-	g := r.Group("/{{.Name}}",  middleware.Auth())
-	{
-		g.POST("/create", a.create)
-		g.POST("/update", a.update)
-		g.POST("/list", a.list)
-		g.POST("/delete", a.delete)
-		g.POST("/detail", a.find)
+// qualified 字段类型，Point 与 dto 中定义的值对象位于项目的 po 包，加上 po. 前缀
+func (f *Field) qualified() string {
+	if t := strings.TrimPrefix(f.Type, "*"); t == "Point" || f.Object {
+		return strings.TrimSuffix(f.Type, t) + "po." + t
 	}
+	return f.Type
 }
 
-// create 创建
-func (a *{{.Name}}) create(c *gin.Context) {
-	var (
-		in  = &model.{{.TitleName}}CreateRequest{}
-		err error
-	)
-
-	if err = c.ShouldBindJSON(in); err != nil {
-		c.Error(err)
-		return
+// OptionalType 可选参数的类型，未传递时为 nil
+func (f *Field) OptionalType() string {
+	if t := f.GoType(); !strings.HasPrefix(t, "*") {
+		return "*" + t
 	}
+	return f.GoType()
+}
 
-	if err = bll.{{.TitleName}}.Create(c.Request.Context(), in); err != nil {
-		c.Error(err)
-		return
+// EntityType 字段在 entity 中的类型，时间字段使用 time.Time，可以为空时使用 *time.Time
+func (f *Field) EntityType() string {
+	switch {
+	case f.IsTime() && f.IsNullable():
+		return "*time.Time"
+	case f.IsTime():
+		return "time.Time"
 	}
-	utils.ResponseOk(c, nil)
+	return f.qualified()
 }
 
-// update 更新
-func (a *{{.Name}}) update(c *gin.Context) {
-	var (
-		in  = &model.{{.TitleName}}UpdateRequest{}
-		err error
-	)
+// ConvertsTime 时间字段在请求与 entity 之间转换时是否需要 time 包
+func (f *Field) ConvertsTime() bool {
+	return f.IsTime() && f.timeFormat() != "rfc3339"
+}
 
-	if err = c.ShouldBindJSON(in); err != nil {
-		c.Error(err)
-		return
+// ToEntity 将请求中非空的值转换为 entity 中的值，v 为 Go 表达式
+func (f *Field) ToEntity(v string) string {
+	if !f.IsTime() {
+		return v
 	}
-
-	if err = bll.{{.TitleName}}.Update(c.Request.Context(), in); err != nil {
-		c.Error(err)
-		return
+	switch f.timeFormat() {
+	case "millis":
+		return "time.UnixMilli(" + v + ")"
+	case "rfc3339":
+		return v
 	}
-	utils.ResponseOk(c, nil)
+	return "time.Unix(" + v + ", 0)"
 }
 
-// list 列表查询
-func (a *{{.Name}}) list(c *gin.Context) {
-	var (
-		in  = &model.{{.TitleName}}ListRequest{}
-		out  = &model.{{.TitleName}}ListResponse{}
-		err error
-	)
-
-	if err = c.ShouldBindJSON(in); err != nil {
-		c.Error(err)
-		return
+// FromEntity 将 entity 中非空的值转换为回包中的值，v 为 Go 表达式
+func (f *Field) FromEntity(v string) string {
+	if !f.IsTime() {
+		return v
 	}
-
-	if out, err = bll.{{.TitleName}}.List(c.Request.Context(), in); err != nil {
-		c.Error(err)
-		return
+	switch f.timeFormat() {
+	case "millis":
+		return v + ".UnixMilli()"
+	case "rfc3339":
+		return v
 	}
-	utils.ResponseOk(c, out)
+	return v + ".Unix()"
 }
 
-// list 列表查询
-func (a *{{.Name}}) find(c *gin.Context) {
-	var (
-		in  = &model.{{.TitleName}}InfoRequest{}
-		out  = &model.{{.TitleName}}Info{}
-		err error
-	)
-
-	if err = c.ShouldBindJSON(in); err != nil {
-		c.Error(err)
-		return
+// Now 自动维护的 created_at、updated_at 字段在 entity 中的当前时间，可以为空的字段在构建 entity 时取地址
+func (f *Field) Now() string {
+	if f.IsTime() {
+		return "time.Now()"
 	}
+	return "time.Now().Unix()"
+}
 
-	if out, err = bll.{{.TitleName}}.Find(c.Request.Context(), in); err != nil {
-		c.Error(err)
-		return
-	}
-	utils.ResponseOk(c, out)
+// protoTypes 字段类型对应的 protobuf 类型
+var protoTypes = map[string]string{
+	"int":            "int64",
+	"int64":          "int64",
+	"int32":          "int32",
+	"int16":          "int32",
+	"int8":           "int32",
+	"uint":           "uint64",
+	"uint64":         "uint64",
+	"uint32":         "uint32",
+	"uint16":         "uint32",
+	"uint8":          "uint32",
+	"byte":           "uint32",
+	"float64":        "double",
+	"float32":        "float",
+	"string":         "string",
+	"bool":           "bool",
+	"[]byte":         "bytes",
+	"pq.StringArray": "repeated string",
+	"pq.Int64Array":  "repeated int64",
 }
 
-// delete 删除
-func (a *{{.Name}}) delete(c *gin.Context) {
-	var (
-		in  = &model.{{.TitleName}}DeleteRequest{}
-		err error
-	)
+// protoGoTypes protobuf 类型在 protoc-gen-go 生成代码中对应的 go 类型
+var protoGoTypes = map[string]string{
+	"double": "float64",
+	"float":  "float32",
+	"bytes":  "[]byte",
+}
 
-	if err = c.ShouldBindJSON(in); err != nil {
-		c.Error(err)
-		return
+// ProtoType 字段对应的 protobuf 类型
+func (f *Field) ProtoType() (string, error) {
+	switch {
+	case f.IsNullable():
+		return "", fmt.Errorf("field %s: nullable field is not supported by protobuf", f.Name)
+	case f.IsTime() && f.GoType() != "int64":
+		return "", fmt.Errorf("field %s: time field in %s format is not supported by protobuf", f.Name, f.timeFormat())
 	}
-
-	if  err = bll.{{.TitleName}}.Delete(c.Request.Context(), in); err != nil {
-		c.Error(err)
-		return
+	if t, ok := protoTypes[f.protoKey()]; ok {
+		return t, nil
 	}
-	utils.ResponseOk(c, nil)
+	return "", fmt.Errorf("field %s: type %s is not supported by protobuf", f.Name, f.Type)
 }
 
-`
-
-var modelTemplate = `
-{{$ID := "Id"}}
-{{$create := "CreatedAt"}}
-{{$true := "true"}}
-{{$false := "false"}}
-
-{{$string := "string"}}
-{{$int64 := "int64"}}
-{{$int32 := "int32"}}
-{{$int := "int"}}
-{{$point := "Point"}}
-{{$strSlice := "pq.StringArray"}}
-{{$int64Slice := "pq.Int64Array"}}
-{{$projectName := .ProjectName}}
-{{$titleName := .TitleName}}
-{{$moduleName := "model"}}
-
-package model
-
-import (
-	"{{.ProjectName}}/model/entity"
-
-	{{range $value :=.Fields}}
-		{{if and (eq $point .Type) (notExist (format $moduleName $point $titleName))}}
-			"{{$projectName}}/model/po"	
-		{{end}}
-
-		{{if or (eq $strSlice .Type) (eq $int64Slice .Type) }}
-			{{if notExist (format $moduleName "pq" $titleName)}}
-				"github.com/lib/pq"
-			{{end}}
-		{{end}}
-	{{end}}
-)
-
-// {{.TitleName}}CreateRequest 创建现场数据
-type {{.TitleName}}CreateRequest struct {
-{{range $value :=.Fields}}
-	{{if ne $ID .Name}} 
-		{{if eq .Parameter $true}}
-			{{if eq .Required $true}}
-				{{if eq $point .Type}} 
-					{{.Name}} po.{{.Type}} {{.Char}}json:"{{$value.JsonTag}}" validate:"required"{{.Char}}
-				{{else}} 
-					{{.Name}} {{.Type}} {{.Char}}json:"{{$value.JsonTag}}" validate:"required"{{.Char}}
-				{{end}}
-			{{else}}
-				{{if eq $point .Type}} 
-					{{.Name}} po.{{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-				{{else}} 
-					{{.Name}} {{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-				{{end}}
-			{{end}}
-		{{end}}
-	{{end}}
-{{end}}
-}
-
-// {{.TitleName}}UpdateRequest 更新现场数据
-type {{.TitleName}}UpdateRequest struct {
-	Id int64 {{.Char}}json:"id"{{.Char}}
-{{range $value :=.Fields}}
-	{{if eq $create .Name}} 
-		{{.Name}} {{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-	{{else if eq .Parameter $true}}
-		{{if eq .Required $true}}
-			{{if eq $point .Type}} 
-				{{.Name}} *po.{{.Type}} {{.Char}}json:"{{$value.JsonTag}}" validate:"required"{{.Char}}
-			{{else}} 
-				{{.Name}} *{{.Type}} {{.Char}}json:"{{$value.JsonTag}}" validate:"required"{{.Char}}
-			{{end}}
-		{{else}}
-			{{if eq $point .Type}} 
-				{{.Name}} *po.{{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-			{{else}} 
-				{{.Name}} *{{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-			{{end}}
-			
-		{{end}}
-	{{end}}
-{{end}}
-}
-
-// {{.TitleName}}ListRequest 列表现场数据
-type {{.TitleName}}ListRequest struct {
-Index int {{.Char}}json:"index"{{.Char}}
-Size int {{.Char}}json:"size"{{.Char}}
-{{range $value :=.Fields}}
-	{{if eq $ID .Name}} 
-		{{.Name}} {{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-	{{else if eq .Parameter $true}}
-		{{if eq .Required $true}}
-			{{if eq $point .Type}} 
-				{{.Name}} *po.{{.Type}} {{.Char}}json:"{{$value.JsonTag}}" validate:"required"{{.Char}}
-			{{else}} 
-				{{.Name}} *{{.Type}} {{.Char}}json:"{{$value.JsonTag}}" validate:"required"{{.Char}}
-			{{end}}
-		{{else}}
-			{{if eq $point .Type}} 
-				{{.Name}} *po.{{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-			{{else}} 
-				{{.Name}} *{{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-			{{end}}
-		{{end}}
-	{{end}}
-{{end}}
-}
-
-
-// {{.TitleName}}ListResponse 列表回包数据
-type {{.TitleName}}ListResponse struct {
-	Total int {{.Char}}json:"total"{{.Char}}
-	List []*{{.TitleName}}Info {{.Char}}json:"list"{{.Char}}
-}
-
-// {{.TitleName}}InfoRequest 列表现场数据
-type {{.TitleName}}InfoRequest struct {
-{{range $value :=.Fields}}
-	{{if eq $ID .Name}} 
-		{{.Name}} {{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-	{{else if eq .Parameter $true}}
-		{{if eq .Required $true}}
-			{{if eq $point .Type}} 
-				{{.Name}} *po.{{.Type}} {{.Char}}json:"{{$value.JsonTag}}" validate:"required"{{.Char}}
-			{{else}} 
-				{{.Name}} *{{.Type}} {{.Char}}json:"{{$value.JsonTag}}" validate:"required"{{.Char}}
-			{{end}}
-		{{else}}
-			{{if eq $point .Type}} 
-				{{.Name}} *po.{{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-			{{else}} 
-				{{.Name}} *{{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-			{{end}}
-		{{end}}
-	{{end}}
-{{end}}
-
-}
-
-// {{.TitleName}}Info 详细数据
-type {{.TitleName}}Info struct {
-{{range $value :=.Fields}}
-	{{if eq $point .Type}} 
-		{{.Name}} po.{{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-	{{else}}
-		{{.Name}} {{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-	{{end}}
-{{end}}
-}
-
-// {{.TitleName}}DeleteRequest 删除现场数据
-type {{.TitleName}}DeleteRequest struct {
-{{range $value :=.Fields}}
-	{{if eq $ID .Name}} 
-		{{.Name}} {{.Type}} {{.Char}}json:"{{$value.JsonTag}}"{{.Char}}
-	{{end}}
-{{end}}
-}
-
-// {{.TitleName}}sEntityToDto entity数据转换
-func {{.TitleName}}sEntityToDto({{.Name}}s []*entity.{{.TitleName}}) []*{{.TitleName}}Info {
-	out := make([]*{{.TitleName}}Info, 0, len({{.Name}}s))
-	for _, c := range {{.Name}}s  {
-		out = append(out, {{.TitleName}}EntityToDto(c))
-	}
-	return out
-}
-
-// {{.TitleName}}EntityToDto entity数据转换
-func {{.TitleName}}EntityToDto(e *entity.{{.TitleName}}) *{{.TitleName}}Info {
-	return &{{.TitleName}}Info{
-		{{range $v :=.Fields}}
-			{{.Name}}: {{if eq .Time $true}}e.{{.Name}}.Unix(),{{else}}e.{{.Name}},{{end}}
-		{{end}}
-	}
-}
-`
-
-var entityTemplate = `
-{{$ID := "Id"}}
-{{$true := "true"}}
-{{$string := "string"}}
-{{$int64 := "int64"}}
-{{$int32 := "int32"}}
-{{$int := "int"}}
-{{$text := "text"}}
-{{$point := "Point"}}
-{{$strSlice := "pq.StringArray"}}
-{{$int64Slice := "pq.Int64Array"}}
-{{$projectName := .ProjectName}}
-{{$titleName := .TitleName}}
-{{$moduleName := "entity"}}
-
-package entity
-
-import (
-	{{range $value :=.Fields}}
-		{{if and (eq $point .Type) (notExist (format $moduleName $point $titleName))}}
-			"{{$projectName}}/model/po"	
-		{{end}}
-
-		{{if or (eq $strSlice .Type) (eq $int64Slice .Type) }}
-			{{if notExist (format $moduleName "pq" $titleName)}}
-				"github.com/lib/pq"
-			{{end}}
-		{{end}}
-	{{end}}
-)
-
-type {{.TitleName}} struct {
-{{range $value :=.Fields}}
-	{{if eq $ID .Name}} 
-		{{.Name}} {{.Type}} {{.Char}}gorm:"column:{{$value.JsonTag}};type:BIGINT;primary_key" json:"{{$value.JsonTag}}"{{.Char}}
-	{{else if eq $true .Time}} 
-		{{.Name}} time.Time {{.Char}}gorm:"column:{{$value.JsonTag}};type:TIMESTAMP" json:"{{$value.JsonTag}}"{{.Char}}
-	{{else if eq $int64 .Type}} 
-		{{.Name}} {{.Type}} {{.Char}}gorm:"column:{{$value.JsonTag}};type:BIGINT" json:"{{$value.JsonTag}}"{{.Char}}
-	{{else if eq $string .Type}} 
-		{{.Name}} {{.Type}} {{.Char}}gorm:"column:{{$value.JsonTag}};type:VARCHAR(255)" json:"{{$value.JsonTag}}"{{.Char}}
-	{{else if eq $int32 .Type}} 
-		{{.Name}} {{.Type}} {{.Char}}gorm:"column:{{$value.JsonTag}};type:TINYINT" json:"{{$value.JsonTag}}"{{.Char}}
-	{{else if eq $int .Type}} 
-		{{.Name}} {{.Type}} {{.Char}}gorm:"column:{{$value.JsonTag}};type:TINYINT" json:"{{$value.JsonTag}}"{{.Char}}
-	{{else if eq $text .Type}} 
-		{{.Name}} {{.Type}} {{.Char}}gorm:"column:{{$value.JsonTag}};type:TEXT" json:"{{$value.JsonTag}}"{{.Char}}
-	{{else if eq $point .Type}} 
-		{{.Name}} po.{{.Type}} {{.Char}}gorm:"column:{{$value.JsonTag}};type:POINT" json:"{{$value.JsonTag}}"{{.Char}}
-	{{else if eq $strSlice .Type}} 
-		{{.Name}} {{.Type}} {{.Char}}gorm:"column:{{$value.JsonTag}};type:VARCHAR[]" json:"{{$value.JsonTag}}"{{.Char}}
-	{{else}} 
-		{{.Name}} {{.Type}} {{.Char}}gorm:"column:{{$value.JsonTag}};type:JSON" json:"{{$value.JsonTag}}"{{.Char}}
-	{{end}}
-{{end}}
-}
-
-func (a *{{.TitleName}}) TableName() string {
-	return "{{.FileName}}s"
-}
-`
-
-var bllTemplate = `
-{{$zero := 0}}
-{{$empty := ""}}
-{{$nil := "nil"}}
-{{$true := "true"}}
-{{$or := "||"}}
-{{$ID := "Id"}}
-{{$CreatedAt := "created_at"}}
-{{$UpdatedAt := "updated_at"}}
-{{$UserId := "user_id"}}
-
-{{$string := "string"}}
-{{$int64 := "int64"}}
-{{$int32 := "int32"}}
-{{$int := "int"}}
-
-{{$projectName := .ProjectName}}
-
-package bll 
-
-import (
-	"context"
-	
-	"{{.ProjectName}}/event"
-	"{{.ProjectName}}/model"
-	"{{.ProjectName}}/model/entity"
-	"{{.ProjectName}}/store"
-	"{{.ProjectName}}/store/postgres"
-	"time"
-
-	{{range $value :=.Fields}}
-		{{if eq $value.JsonTag "user_id" }}
-			"{{$projectName}}/auth"
-		{{end}}
-	{{end}}
-)
+// protoKey 查找 protobuf 类型时使用的字段类型，时间字段使用请求中的类型
+func (f *Field) protoKey() string {
+	if f.IsTime() {
+		return f.GoType()
+	}
+	return f.Type
+}
 
-type {{.Name}} struct{
-	i{{.TitleName}} store.I{{.TitleName}}
+// IsRepeated 是否为 protobuf 中的 repeated 字段
+func (f *Field) IsRepeated() bool {
+	return strings.HasPrefix(protoTypes[f.protoKey()], "repeated ")
 }
 
-var {{.TitleName}} = &{{.Name}}{
-	i{{.TitleName}}: postgres.{{.TitleName}},
+// ProtoGoType 字段在 protoc-gen-go 生成代码中的类型
+func (f *Field) ProtoGoType() string {
+	t := strings.TrimPrefix(protoTypes[f.protoKey()], "repeated ")
+	if v, ok := protoGoTypes[t]; ok {
+		t = v
+	}
+	if f.IsRepeated() {
+		return "[]" + t
+	}
+	return t
 }
 
-func (a *{{.Name}}) init()     func()   {
-	return func() {}
+// JsonName 字段的 json 名称，不包含 omitempty 等选项
+func (f *Field) JsonName() string {
+	if name := strings.Split(f.Json, ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return Camel2Case(f.Name)
 }
 
-func (a *{{.Name}}) onEvent(*event.Data) {}
+// ProtoName 字段在 protobuf 中的名称，与 json 名称一致
+func (f *Field) ProtoName() string {
+	return f.JsonName()
+}
 
-// Create 创建
-func (a *{{.Name}}) Create(ctx context.Context, in *model.{{.TitleName}}CreateRequest) error  {
+// PbName 字段在 protoc-gen-go 生成代码中的名称，规则与 protoc-gen-go 一致
+func (f *Field) PbName() string {
 	var (
-		err error
+		s   = f.ProtoName()
+		out = make([]byte, 0, len(s))
 	)
-	
-	{{range $v := .Fields}}
-		{{if eq .Json $UserId}}
-			// 获取用户Id
-			in.UserId, _ = auth.ContextUserID(ctx)
-		{{end}}
-	{{end}}
-
-	// 构建创建现场数据
-	c := build{{.TitleName}}(in)
-	_, err = a.i{{.TitleName}}.Create(ctx,c)
-	return err
-}
-
-// Update 更新
-func (a *{{.Name}}) Update(ctx context.Context, in *model.{{.TitleName}}UpdateRequest) error  {
-	var (
-		dict = make(map[string]interface{})
-	)
-	{{range $v := .Fields}}
-		{{if eq .Parameter $true}}
-			{{if ne .Required $true}}
-			if in.{{.Name}} != nil {
-				dict["{{.Json}}"] = in.{{.Name}}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_' && i == 0:
+			out = append(out, 'X')
+		case c == '_' && i+1 < len(s) && 'a' <= s[i+1] && s[i+1] <= 'z':
+		case '0' <= c && c <= '9':
+			out = append(out, c)
+		default:
+			if 'a' <= c && c <= 'z' {
+				c -= 'a' - 'A'
 			}
-			{{end}}
-		{{end}}
-	{{end}}
-	// do other update here
-	updateAt := time.Now().Unix()
-	in.UpdatedAt = &updateAt
-	return a.i{{.TitleName}}.Update(ctx, in.Id, dict)
+			out = append(out, c)
+			for ; i+1 < len(s) && 'a' <= s[i+1] && s[i+1] <= 'z'; i++ {
+				out = append(out, s[i+1])
+			}
+		}
+	}
+	return string(out)
 }
 
-// Delete 删除
-func (a *{{.Name}}) Delete(ctx context.Context, in *model.{{.TitleName}}DeleteRequest) error  {
-	return a.i{{.TitleName}}.Delete(ctx,in.Id)
+// FieldNumber protobuf 字段编号，offset 为消息中前置字段的数量
+// 优先使用 proto tag 指定的编号，未指定时按字段在结构体中的位置生成，插入或调整字段顺序会改变编号
+func (g *Generate) FieldNumber(f *Field, offset int) int {
+	if n, err := strconv.Atoi(f.Proto); err == nil {
+		return n + offset
+	}
+	for i, v := range g.Fields {
+		if v == f {
+			return i + 1 + offset
+		}
+	}
+	return 0
 }
 
-// List 列表查询
-func (a *{{.Name}}) List(ctx context.Context, in *model.{{.TitleName}}ListRequest) (*model.{{.TitleName}}ListResponse, error)  {
-	var (
-		err error
-		total int
-		list []*entity.{{.TitleName}} 
-		out = &model.{{.TitleName}}ListResponse{}
-	)
+// HasType 是否包含指定类型的字段
+func (g *Generate) HasType(types ...string) bool {
+	for _, f := range g.Fields {
+		for _, t := range types {
+			if f.Type == t {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-	if total, list, err = a.i{{.TitleName}}.List(ctx,in); err != nil {
-		return nil, err
+// HasPo 是否有字段使用项目 po 包中的类型
+func (g *Generate) HasPo() bool {
+	for _, f := range g.Fields {
+		if strings.HasPrefix(strings.TrimPrefix(f.qualified(), "*"), "po.") {
+			return true
+		}
 	}
-	
-	out.Total = total
-	out.List = model.{{.TitleName}}sEntityToDto(list)
+	return false
+}
 
-	return out, nil
+// HasJson 是否包含指定 json 名称的字段
+func (g *Generate) HasJson(name string) bool {
+	for _, f := range g.Fields {
+		if f.Json == name {
+			return true
+		}
+	}
+	return false
 }
 
-// Find 列表查询
-func (a *{{.Name}}) Find(ctx context.Context, in *model.{{.TitleName}}InfoRequest) (*model.{{.TitleName}}Info, error)  {
-	var (
-		err error
-		data *entity.{{.TitleName}} 
-		out = &model.{{.TitleName}}Info{}
-	)
+// HasID 是否包含 Id 字段
+func (g *Generate) HasID() bool {
+	for _, f := range g.Fields {
+		if f.Name == "Id" {
+			return true
+		}
+	}
+	return false
+}
 
-	if data, err = a.i{{.TitleName}}.Find(ctx,in); err != nil {
+type Field struct {
+	Name       string
+	Type       string
+	Json       string
+	Required   string
+	Parameter  string
+	JsonTag    string
+	Validate   string // validate 规则，如 oneof=1 2、min=1
+	Default    string // 列的默认值
+	Index      string // 是否创建索引
+	Unique     string // 是否创建唯一索引
+	DBType     string // 列类型，覆盖类型映射中的列类型
+	TimeFormat string // 时间字段在请求与回包中的格式，为空时使用生成选项中的格式
+	Nested     string // 结构体字段的存储方式：json（默认）、flatten
+	Rel        string // 与其他实体的关联，如 belongs_to:User
+	Proto      string // protobuf 字段编号，为空时按字段在结构体中的位置生成
+	Primary    bool   // 是否为联合主键中的列，仅用于 many_to_many 的中间表
+	Object     bool   // 是否为 dto 中定义的值对象，以 JSON 存储，生成的代码中使用项目 po 包中的同名类型
+	Column     string // 当前方言中的列类型，渲染模板前设置
+	Time       string
+	Char       string
+	Comment    string // 字段注释，仅在解析源码时存在
+	Tag        string // 原始的 tag，仅在通过结构体声明时存在
+	Pos        string // 定义所在的位置 file:line，仅在解析源码与描述文件时存在
+}
+
+// layers 内置的层，按生成顺序排列
+var layers = []string{"api", "model", "entity", "bll", "store", "postgres", "proto", "grpc", "openapi", "migration"}
+
+// disabled 默认不生成的内置层，可通过 -layer 或配置中的 enabled 启用
+var disabled = []string{"proto", "grpc", "openapi", "migration"}
+
+// versioned 文件名带有版本号的层，如 20240102150405_create_users.up.sql
+var versioned = []string{"migration"}
+
+// exts 生成文件的扩展名，未列出的层为 .go
+var exts = map[string]string{
+	"proto":     ".proto",
+	"openapi":   ".yaml",
+	"migration": ".sql",
+}
+
+// files 所有实体共用同一个文件的层，各实体生成的内容会合并到此文件
+var files = map[string]string{
+	"openapi": "openapi.yaml",
+}
+
+// addr 默认存储位置，可通过 generator.yaml 覆盖
+var addr = map[string]string{
+	"api":       "/server/web/v1/", // 接口存储位置
+	"model":     "/model/",         // model 生成文件存储位置
+	"entity":    "/model/entity/",
+	"postgres":  "/store/postgres/",
+	"store":     "/store/",
+	"bll":       "/bll/",
+	"proto":     "/proto/",      // protobuf 定义
+	"grpc":      "/server/rpc/", // gRPC 服务实现
+	"openapi":   "/docs/",       // OpenAPI 文档
+	"migration": "/migrations/", // 数据库迁移
+}
+
+// routes 可选的路由风格
+var routes = []string{"rpc", "rest"}
+
+// frameworks api 层可选框架对应的内置模板
+var frameworks = map[string]string{
+	"gin":      "api.tmpl",
+	"echo":     "api_echo.tmpl",
+	"chi":      "api_chi.tmpl",
+	"net/http": "api_http.tmpl",
+}
+
+// m 各层使用的内置模板，位于 templates 目录
+var m = map[string]string{
+	"api":       "api.tmpl",
+	"model":     "model.tmpl",
+	"bll":       "bll.tmpl",
+	"store":     "store.tmpl",
+	"postgres":  "postgres.tmpl",
+	"entity":    "entity.tmpl",
+	"proto":     "proto.tmpl",
+	"grpc":      "grpc.tmpl",
+	"openapi":   "openapi.tmpl",
+	"migration": "migration.tmpl",
+}
+
+// parse 渲染模板并格式化生成的 go 代码
+func parse(p *template.Template, generator *Generate) ([]byte, error) {
+	src, err := execute(p, generator)
+	if err != nil {
 		return nil, err
 	}
-	
-	out = model.{{.TitleName}}EntityToDto(data)
-	return out, nil
+	return format.Source(src)
 }
 
-// build{{.TitleName}} 构建创建数据现场
-func build{{.TitleName}}(in *model.{{.TitleName}}CreateRequest) *entity.{{.TitleName}} {
-	// todo: check the entity is required
-	return &entity.{{.TitleName}}{
-		{{range $v :=.Fields}}
-			{{if eq .Json $CreatedAt}}
-				{{.Name}}:time.Now().Unix(),
-			{{else if eq .Json $UpdatedAt}}
-				{{.Name}}:time.Now().Unix(),
-			{{else}}
-				{{if ne .Name $ID}}{{.Name}}: {{if eq .Parameter $true}} {{if ne .Required $true}}in.{{.Name}},{{else}}in.{{.Name}},{{end}}{{else}}{{if eq .Type $string}}"",{{else}}0,{{end}}{{end}}{{end}}
-			{{end}}
-		{{end}}
-	} 
+// execute 渲染模板
+func execute(p *template.Template, generator *Generate) ([]byte, error) {
+	var buf = bytes.NewBuffer([]byte{})
+	generator.bind()
+	if err := p.Execute(buf, generator); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
-`
-
-var storeTemplate = `
-{{$true := "true"}}
-{{$string := "string"}}
 
-package postgres
-
-import (
-	"context"
-	"gorm.io/gorm"
-	"{{.ProjectName}}/errors"
-	"{{.ProjectName}}/model"
-	"{{.ProjectName}}/model/entity"
-)
-
-var {{.TitleName}} = &{{.Name}}{}
-
-type {{.Name}} struct{}
-
-// Create 创建
-func (a *{{.Name}}) Create(ctx context.Context, m *entity.{{.TitleName}}) (int64, error) {
-	err := GetDB(ctx).Create(m).Error
-	return m.Id, err
+// formatSource 格式化生成的文件，go 文件使用 gofmt，YAML 文件重新编码，其余文件只整理空白行
+func formatSource(filename string, src []byte) ([]byte, error) {
+	switch filepath.Ext(filename) {
+	case ".go":
+		return format.Source(src)
+	case ".yaml", ".yml":
+		return formatYAML(src)
+	}
+	return tidy(src), nil
 }
 
-// Find 查找详情
-func (a *{{.Name}}) Find(ctx context.Context, in *model.{{.TitleName}}InfoRequest ) (*entity.{{.TitleName}}, error ){
-	e := &entity.{{.TitleName}}{}
-
-	q := GetDB(ctx).Model(&entity.{{.TitleName}}{})
-
-	if in.Id > 0 {
-		err := q.First(&e, in.Id).Error
-		return e, err
+// tidy 去除行尾空白、合并连续的空行，并去掉花括号内首尾的空行
+func tidy(src []byte) []byte {
+	var (
+		buf   bytes.Buffer
+		blank bool
+		last  string
+	)
+	for _, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			blank = true
+			continue
+		}
+		if blank && last != "" && !strings.HasSuffix(last, "{") && !strings.HasPrefix(strings.TrimSpace(line), "}") {
+			buf.WriteString("\n")
+		}
+		blank, last = false, line
+		buf.WriteString(line)
+		buf.WriteString("\n")
 	}
+	return buf.Bytes()
+}
 
-	count := 0 
-	{{range $v := .Fields}}
-		{{if eq .Parameter $true}}
-			{{if ne .Required $true}}
-			if in.{{.Name}} != nil {
-				{{if eq $string .Type}}
-					q = q.Where("{{.Json}} like ?", in.{{.Name}}) 
-				{{else}}
-					q = q.Where("{{.Json}} = ?", in.{{.Name}}) 
-				{{end}}
-				count++
+func Camel2Case(name string) string {
+	buffer := NewBuffer()
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i != 0 {
+				buffer.Append('_')
 			}
-			{{end}}
-		{{end}}
-	{{end}}
-
-	if count == 0 {
-		return e, errors.New("condition illegal")
+			buffer.Append(unicode.ToLower(r))
+		} else {
+			buffer.Append(r)
+		}
 	}
-
-	err := q.First(&e).Error
-	return e, err
+	return buffer.String()
 }
 
-// Update 更新
-func (a *{{.Name}}) Update(ctx context.Context, id int64, dict map[string]interface{}) error {
-	return GetDB(ctx).Model(&entity.{{.TitleName}}{}).Where("id = ?", id).Updates(dict).Error
+// Case2Camel 下划线命名转换为驼峰命名，如 charge_monitor => ChargeMonitor
+func Case2Camel(name string) string {
+	parts := strings.Split(name, "_")
+	for i, part := range parts {
+		parts[i] = Ucfirst(part)
+	}
+	return strings.Join(parts, "")
 }
 
-// Delete 删除
-func (a *{{.Name}}) Delete(ctx context.Context,id int64) error {
-	return GetDB(ctx).Delete(&entity.{{.TitleName}}{}, id).Error
+func LeftToLower(s string) string {
+	if len(s) > 0 {
+		return strings.ToLower(string(s[0])) + s[1:]
+	}
+	return s
 }
 
-// List 列表查询
-func (a *{{.Name}}) List(ctx context.Context,in *model.{{.TitleName}}ListRequest) (int, []*entity.{{.TitleName}}, error) {
-	var (
-		q        = GetDB(ctx).Model(&entity.{{.TitleName}}{})
-		err      error
-		total    int64
-		{{.Name}}s []*entity.{{.TitleName}}
-	)
-
-	{{range $v := .Fields}}
-		{{if eq .Parameter $true}}
-			{{if ne .Required $true}}
-			if in.{{.Name}} != nil {
-				{{if eq $string .Type}}
-					q = q.Where("{{.Json}} like ?", in.{{.Name}}) 
-				{{else}}
-					q = q.Where("{{.Json}} = ?", in.{{.Name}}) 
-				{{end}}
-				
-			}
-			{{end}}
-		{{end}}
-	{{end}}
-
-	if err = q.Count(&total).Error; err != nil {
-		return 0, nil, err
+func Ucfirst(str string) string {
+	for i, v := range str {
+		return string(unicode.ToUpper(v)) + str[i+1:]
 	}
-	if err = q.Limit(in.Size).Offset((in.Index - 1) * in.Size).Find(&{{.Name}}s).Error; err != nil {
-		return 0, nil, err
+	return ""
+}
+
+func Lcfirst(str string) string {
+	for i, v := range str {
+		return string(unicode.ToLower(v)) + str[i+1:]
 	}
-	return int(total), {{.Name}}s, nil
+	return ""
 }
 
-// ExecTransaction db事务执行
-func (a *{{.Name}}) ExecTransaction(ctx context.Context, callback func(ctx context.Context) error) error {
-	return GetDB(ctx).Transaction(func(tx *gorm.DB) error {
-		ctx = context.WithValue(ctx, DBCONTEXTKEY, tx)
-		return callback(ctx)
-	})
+type Buffer struct {
+	*bytes.Buffer
 }
-`
 
-var interfaceTemplate = `
-package store
+func NewBuffer() *Buffer {
+	return &Buffer{Buffer: new(bytes.Buffer)}
+}
 
-import (
-	"context"
-	"{{.ProjectName}}/model"
-	"{{.ProjectName}}/model/entity"
-)
+func (b *Buffer) Append(i interface{}) *Buffer {
+	switch val := i.(type) {
+	case int:
+		b.append(strconv.Itoa(val))
+	case int64:
+		b.append(strconv.FormatInt(val, 10))
+	case uint:
+		b.append(strconv.FormatUint(uint64(val), 10))
+	case uint64:
+		b.append(strconv.FormatUint(val, 10))
+	case string:
+		b.append(val)
+	case []byte:
+		b.Write(val)
+	case rune:
+		b.WriteRune(val)
+	}
+	return b
+}
 
-type I{{.TitleName}} interface {
-	// Create 创建
-	Create(ctx context.Context, e *entity.{{.TitleName}}) (int64, error)
-	// Find 查找详情
-	Find(ctx context.Context, in *model.{{.TitleName}}InfoRequest) (*entity.{{.TitleName}}, error)
-	// Update 更新
-	Update(ctx context.Context, id int64, updates map[string]interface{}) (error)
-	// Delete 删除
-	Delete(ctx context.Context, id int64) (error)
-	// List 列表查询
-	List(ctx context.Context, in *model.{{.TitleName}}ListRequest) (int, []*entity.{{.TitleName}}, error)
-	// ExecTransaction db事务执行
-	ExecTransaction(ctx context.Context, callback func(ctx context.Context) error) error 
-}
-`
+func (b *Buffer) append(s string) *Buffer {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Println("*****内存不够了！******")
+		}
+	}()
+	b.WriteString(s)
+	return b
+}
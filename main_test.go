@@ -0,0 +1,1559 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"text/template"
+
+	"generator/dto"
+
+	"gopkg.in/yaml.v3"
+)
+
+var update = flag.Bool("update", false, "更新 testdata 中的 golden 文件")
+
+// builtin 加载内置模板
+func builtin(t *testing.T, name string) *template.Template {
+	t.Helper()
+	p, err := newTemplate(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// findFunc 查找生成代码中的函数，name 为函数名或 Type.Method 形式的方法名，不存在时测试失败
+func findFunc(t *testing.T, src []byte, name string) (*token.FileSet, *ast.FuncDecl) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range file.Decls {
+		fn, ok := d.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		method := fn.Name.Name
+		if fn.Recv != nil && len(fn.Recv.List) > 0 {
+			recv := fn.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			if ident, ok := recv.(*ast.Ident); ok {
+				method = ident.Name + "." + method
+			}
+		}
+		if fn.Name.Name == name || method == name {
+			return fset, fn
+		}
+	}
+	t.Fatalf("func %s not found in:\n%s", name, src)
+	return nil, nil
+}
+
+// funcDecl 返回生成代码中指定函数或方法的完整声明，不存在时测试失败
+func funcDecl(t *testing.T, src []byte, name string) string {
+	t.Helper()
+	fset, fn := findFunc(t, src, name)
+	return string(src[fset.Position(fn.Pos()).Offset:fset.Position(fn.End()).Offset])
+}
+
+// statements 生成代码中函数内的各个语句与表达式，name 与 findFunc 相同，逐个格式化后不受 gofmt 对齐的影响，函数不存在时测试失败
+func statements(t *testing.T, src []byte, name string) []string {
+	t.Helper()
+	var (
+		fset, fn = findFunc(t, src, name)
+		out      = make([]string, 0)
+	)
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n.(type) {
+		case ast.Stmt, ast.Expr:
+			var buf bytes.Buffer
+			if err := printer.Fprint(&buf, fset, n); err == nil {
+				out = append(out, buf.String())
+			}
+		}
+		return true
+	})
+	return out
+}
+
+// imports 生成代码中 import 的包路径
+func imports(t *testing.T, src []byte) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]string, 0, len(file.Imports))
+	for _, spec := range file.Imports {
+		out = append(out, strings.Trim(spec.Path.Value, `"`))
+	}
+	return out
+}
+
+// member 生成代码中结构体字段或接口方法的声明，如 Name string `json:"name"`，不存在时测试失败
+// 声明按 AST 中的类型与 tag 拼接，不受 gofmt 对齐的影响
+func member(t *testing.T, src []byte, typeName, name string) string {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := func(n ast.Node) string {
+		return string(src[fset.Position(n.Pos()).Offset:fset.Position(n.End()).Offset])
+	}
+	for _, d := range file.Decls {
+		gen, ok := d.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			var fields *ast.FieldList
+			if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == typeName {
+				switch typ := ts.Type.(type) {
+				case *ast.StructType:
+					fields = typ.Fields
+				case *ast.InterfaceType:
+					fields = typ.Methods
+				}
+			}
+			if fields == nil {
+				continue
+			}
+			for _, f := range fields.List {
+				for _, n := range f.Names {
+					if n.Name != name {
+						continue
+					}
+					out := name + " " + text(f.Type)
+					if _, ok := f.Type.(*ast.FuncType); ok {
+						out = name + text(f.Type)
+					}
+					if f.Tag != nil {
+						out += " " + f.Tag.Value
+					}
+					return out
+				}
+			}
+		}
+	}
+	t.Fatalf("%s.%s not found in:\n%s", typeName, name, src)
+	return ""
+}
+
+// fixture 将 dto 源码写入临时目录中的 dto.go 并加载，返回文件路径与解析关联后的生成模型
+func fixture(t *testing.T, src string) (string, []*Generate) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "dto.go")
+	if err := os.WriteFile(filename, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	list, err := loadSource("manager", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relate(list)
+	return filename, list
+}
+
+// rendered 使用内置模板渲染生成模型，返回格式化后的代码
+func rendered(t *testing.T, name string, generator *Generate) []byte {
+	t.Helper()
+	src, err := parse(builtin(t, name), generator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+// declaration 期望的生成代码：结构体字段、接口方法，或函数中的语句与表达式
+type declaration struct {
+	layer string
+	decl  string // 类型或函数名称
+	name  string // 字段或方法名称，为空时 want 为 decl 函数中的语句或表达式
+	want  string
+}
+
+// check 渲染生成模型并检查声明
+func (d *declaration) check(t *testing.T, generator *Generate) {
+	t.Helper()
+	src := rendered(t, d.layer, generator)
+	if d.name != "" {
+		if got := member(t, src, d.decl, d.name); got != d.want {
+			t.Errorf("%s %s.%s: expected %s, got %s", d.layer, d.decl, d.name, d.want, got)
+		}
+		return
+	}
+	if !contains(statements(t, src, d.decl), d.want) {
+		t.Errorf("%s %s: expected %s in:\n%s", d.layer, d.decl, d.want, funcDecl(t, src, d.decl))
+	}
+}
+
+// sample 使用 dto.User 构建生成模型
+func sample(t *testing.T) *Generate {
+	t.Helper()
+	generator, err := newGenerate("manager", dto.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return generator
+}
+
+func TestTemplates(t *testing.T) {
+	for _, k := range layers {
+		t.Run(k, func(t *testing.T) {
+			l := &layer{Name: k, Ext: exts[k], Template: builtin(t, k)}
+			for _, part := range l.parts() {
+				var (
+					name = k
+					p    = l.Template
+				)
+				if part != "" {
+					name, p = k+"."+part, l.Template.Lookup(part)
+				}
+				src, err := execute(p, sample(t))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if src, err = formatSource(name+l.ext(), src); err != nil {
+					t.Fatal(err)
+				}
+				golden(t, name, src)
+			}
+		})
+	}
+}
+
+// TestFrameworkTemplates 每个框架在两种路由风格下的 api 层
+func TestFrameworkTemplates(t *testing.T) {
+	for framework, file := range frameworks {
+		for _, route := range routes {
+			name := "api." + path.Base(framework) + "." + route
+			t.Run(name, func(t *testing.T) {
+				generator := sample(t)
+				generator.Framework, generator.Route = framework, route
+				src, err := parse(builtin(t, file), generator)
+				if err != nil {
+					t.Fatal(err)
+				}
+				golden(t, name, src)
+			})
+		}
+	}
+}
+
+// golden 与 testdata 中的 golden 文件比较，-update 时先写入
+func golden(t *testing.T, name string, src []byte) {
+	t.Helper()
+	filename := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(filename, src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Errorf("%s mismatch:\n%s", name, unifiedDiff("want", "got", want, src))
+	}
+}
+
+func TestTemplatesNoEscape(t *testing.T) {
+	generator := sample(t)
+	generator.Fields[1].Json = "face<1>&'x'"
+	generator.Fields[1].JsonTag = generator.Fields[1].Json
+
+	src, err := parse(builtin(t, "entity"), generator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "json:\"face<1>&'x'\""; !bytes.Contains(src, []byte(want)) {
+		t.Errorf("expected %s in output:\n%s", want, src)
+	}
+}
+
+func TestTemplatesImports(t *testing.T) {
+	generator := newGenerator("manager", "Device")
+	generator.Fields = []*Field{
+		{Name: "Id", Type: "int64", Json: "id", JsonTag: "id", Char: "`"},
+		{Name: "Location", Type: "Point", Json: "location", JsonTag: "location", Char: "`"},
+		{Name: "Tags", Type: "pq.StringArray", Json: "tags", JsonTag: "tags", Char: "`"},
+	}
+
+	// 多次渲染都需要包含 import
+	for i := 0; i < 2; i++ {
+		for _, k := range []string{"model", "entity"} {
+			src, err := parse(builtin(t, k), generator)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{`"manager/model/po"`, `"github.com/lib/pq"`} {
+				if !bytes.Contains(src, []byte(want)) {
+					t.Errorf("%s: expected import %s:\n%s", k, want, src)
+				}
+			}
+		}
+	}
+}
+
+func TestTemplateOverride(t *testing.T) {
+	dir := t.TempDir()
+	override := `{{define "table_name"}}
+func (a *{{.TitleName}}) TableName() string {
+	return "t_{{.FileName}}"
+}
+{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "entity.tmpl"), []byte(override), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := newTemplate("entity", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := parse(p, sample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只替换 table_name，其余部分保持内置模板的内容
+	if !bytes.Contains(src, []byte(`return "t_user"`)) || !bytes.Contains(src, []byte("type User struct")) {
+		t.Errorf("unexpected output:\n%s", src)
+	}
+}
+
+func TestMigrationAlter(t *testing.T) {
+	old := sample(t)
+	generator := sample(t)
+	// 删除 face，修改 vibration 的类型，新增带索引的 imei
+	generator.Fields = append([]*Field{generator.Fields[0]}, generator.Fields[2:]...)
+	generator.Fields = append(generator.Fields, &Field{Name: "Imei", Type: "string", Json: "imei", Index: "true"})
+	generator.Fields[2].Type = "int32"
+
+	changes := diffSchema(old.Schema(), generator.Schema())
+	destructive := 0
+	for _, c := range changes {
+		if c.Destructive() {
+			destructive++
+		}
+	}
+	if destructive != 2 {
+		t.Errorf("expected 2 destructive changes, got %d: %v", destructive, changes)
+	}
+
+	p := builtin(t, "migration")
+	generator.Changes = changes
+	for part, want := range map[string][]string{
+		"up": {
+			`ALTER TABLE "users" DROP COLUMN "face";`,
+			`ALTER TABLE "users" ALTER COLUMN "vibration" TYPE INTEGER;`,
+			`ALTER TABLE "users" ADD COLUMN "imei" VARCHAR(255);`,
+			`CREATE INDEX IF NOT EXISTS "idx_users_imei" ON "users" ("imei");`,
+		},
+		"down": {
+			`DROP INDEX IF EXISTS "idx_users_imei";`,
+			`ALTER TABLE "users" DROP COLUMN "imei";`,
+			`ALTER TABLE "users" ALTER COLUMN "vibration" TYPE BIGINT;`,
+			`ALTER TABLE "users" ADD COLUMN "face" BIGINT;`,
+		},
+	} {
+		src, err := execute(p.Lookup(part), generator)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range want {
+			if !bytes.Contains(src, []byte(line)) {
+				t.Errorf("%s: expected %s in output:\n%s", part, line, src)
+			}
+		}
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	ddl := filepath.Join(t.TempDir(), "schema.sql")
+	err := os.WriteFile(ddl, []byte("CREATE TABLE `devices` (\n"+
+		"  `id` int unsigned NOT NULL AUTO_INCREMENT,\n"+
+		"  `imei` varchar(32) NOT NULL COMMENT 'IMEI',\n"+
+		"  `status` tinyint NOT NULL DEFAULT '1',\n"+
+		"  `name` varchar(64) DEFAULT 'it\\'s',\n"+
+		"  `enabled` tinyint(1) NOT NULL DEFAULT '0',\n"+
+		"  `hits` int unsigned NOT NULL DEFAULT '0',\n"+
+		"  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,\n"+
+		"  PRIMARY KEY (`id`),\n"+
+		"  UNIQUE KEY `uk_imei` (`imei`),\n"+
+		"  KEY `idx_status_name` (`status`, `name`)\n"+
+		") ENGINE=InnoDB COMMENT='设备';\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	o := &options{DDL: ddl, Dialect: "mysql", Package: "dto"}
+	if err = runIntrospect(o, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("// Device 设备\ntype Device struct {")) {
+		t.Errorf("expected the table comment on Device:\n%s", buf.String())
+	}
+	for name, want := range map[string]string{
+		"Id":        "Id int64 `json:\"id\"`",
+		"Imei":      "Imei string `json:\"imei\" parameter:\"true\" required:\"true\" unique:\"true\" db_type:\"VARCHAR(32)\"`",
+		"Status":    "Status int8 `json:\"status\" parameter:\"true\" default:\"1\"`",
+		"Name":      "Name string `json:\"name\" parameter:\"true\" default:\"it's\" db_type:\"VARCHAR(64)\"`",
+		"Enabled":   "Enabled bool `json:\"enabled\" parameter:\"true\" default:\"false\"`",
+		"Hits":      "Hits uint32 `json:\"hits\" parameter:\"true\" default:\"0\"`",
+		"CreatedAt": "CreatedAt time.Time `json:\"created_at\" db_type:\"DATETIME\"`",
+	} {
+		if got := member(t, buf.Bytes(), "Device", name); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+}
+
+// fakeConnector 按查询语句中的关键字返回固定结果的 database/sql 连接，用于测试读取表结构
+type fakeConnector map[string][][]driver.Value
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn fakeConnector
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	for key, rows := range c {
+		if strings.Contains(query, key) {
+			return fakeStmt(rows), nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected query: %s", query)
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type fakeStmt [][]driver.Value
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) { return &fakeRows{rows: s}, nil }
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestLoadDatabase(t *testing.T) {
+	for _, c := range []struct {
+		dialect string
+		load    func(querier) ([]*Schema, error)
+		results fakeConnector
+		want    []string
+	}{
+		{"postgres", loadPostgres, fakeConnector{
+			"pg_attribute a ON a.attrelid = c.oid": {
+				{"devices", "id", "bigint", true, "nextval('devices_id_seq'::regclass)", "", "设备"},
+				{"devices", "imei", "character varying(32)", true, "", "IMEI", "设备"},
+				{"devices", "status", "smallint", true, "1", "", "设备"},
+				{"devices", "name", "character varying(64)", false, "'it''s'::character varying", "", "设备"},
+				{"devices", "created_at", "timestamp with time zone", false, "now()", "", "设备"},
+			},
+			"pg_index": {
+				{"devices", "id", true, true},
+				{"devices", "imei", false, true},
+				{"devices", "status", false, false},
+			},
+		}, []string{
+			"Id int64 `json:\"id\"`",
+			"Imei string `json:\"imei\" parameter:\"true\" required:\"true\" unique:\"true\" db_type:\"CHARACTER VARYING(32)\"`",
+			"Status int16 `json:\"status\" parameter:\"true\" default:\"1\" index:\"true\"`",
+			"Name string `json:\"name\" parameter:\"true\" default:\"it's\" db_type:\"CHARACTER VARYING(64)\"`",
+			"CreatedAt *time.Time `json:\"created_at\" db_type:\"TIMESTAMP WITH TIME ZONE\"`",
+		}},
+		{"mysql", loadMySQL, fakeConnector{
+			"information_schema.COLUMNS": {
+				{"devices", "id", "bigint unsigned", int64(1), nil, "", "设备"},
+				{"devices", "imei", "varchar(32)", int64(1), nil, "IMEI", "设备"},
+				{"devices", "name", "varchar(64)", int64(0), "it's", "", "设备"},
+				{"devices", "enabled", "tinyint(1)", int64(1), "0", "", "设备"},
+			},
+			"information_schema.STATISTICS": {
+				{"devices", "id", int64(1), int64(1)},
+				{"devices", "imei", int64(0), int64(1)},
+				{"devices", "name", int64(0), int64(0)},
+			},
+		}, []string{
+			"Id int64 `json:\"id\"`",
+			"Imei string `json:\"imei\" parameter:\"true\" required:\"true\" unique:\"true\" db_type:\"VARCHAR(32)\"`",
+			"Name string `json:\"name\" parameter:\"true\" default:\"it's\" index:\"true\" db_type:\"VARCHAR(64)\"`",
+			"Enabled bool `json:\"enabled\" parameter:\"true\" default:\"false\"`",
+		}},
+	} {
+		t.Run(c.dialect, func(t *testing.T) {
+			db := sql.OpenDB(c.results)
+			defer db.Close()
+			list, err := c.load(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 1 || list[0].Table != "devices" || list[0].Comment != "设备" || list[0].Dialect != c.dialect {
+				t.Fatalf("expected table devices, got %+v", list)
+			}
+			e := newDtoEntity(list[0])
+			var got []string
+			for _, f := range e.Fields {
+				got = append(got, f.Name+" "+f.Type+" `"+f.StructTag()+"`")
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected fields:\n%s\ngot:\n%s", strings.Join(c.want, "\n"), strings.Join(got, "\n"))
+			}
+			if imei := e.Fields[1]; imei.Comment != "IMEI" {
+				t.Errorf("expected column comment IMEI, got %q", imei.Comment)
+			}
+		})
+	}
+}
+
+func TestLoadDDL(t *testing.T) {
+	ddl := filepath.Join(t.TempDir(), "schema.sql")
+	err := os.WriteFile(ddl, []byte(`
+CREATE TABLE public.user_info (
+    id bigint NOT NULL,
+    nick character varying(32) NOT NULL,
+    level smallint DEFAULT 1 NOT NULL,
+    login_at timestamp without time zone
+);
+COMMENT ON TABLE public.user_info IS '用户信息';
+ALTER TABLE ONLY public.user_info ADD CONSTRAINT user_info_pkey PRIMARY KEY (id);
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := loadDDL("manager", ddl, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].TitleName != "UserInfo" || list[0].Table() != "user_info" || list[0].Comment != "用户信息" {
+		t.Fatalf("unexpected entities: %+v", list)
+	}
+	for _, f := range list[0].Fields {
+		got := f.Type + " " + f.StructTag()
+		want := map[string]string{
+			"Id":      `int64 json:"id"`,
+			"Nick":    `string json:"nick" parameter:"true" required:"true" db_type:"CHARACTER VARYING(32)"`,
+			"Level":   `int16 json:"level" parameter:"true" default:"1"`,
+			"LoginAt": `*time.Time json:"login_at" parameter:"true"`,
+		}[f.Name]
+		if got != want {
+			t.Errorf("%s: expected %s, got %s", f.Name, want, got)
+		}
+	}
+
+	src, err := parse(builtin(t, "entity"), list[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`return "user_info"`, `gorm:"column:nick;type:CHARACTER VARYING(32)"`} {
+		if !bytes.Contains(src, []byte(want)) {
+			t.Errorf("expected %s in entity:\n%s", want, src)
+		}
+	}
+}
+
+func TestLoadSource(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"user.go": "package dto\n\n" +
+			"// BaseModel 公共字段\n" +
+			"type BaseModel struct {\n" +
+			"\tId        int64 `json:\"id\"`\n" +
+			"\tCreatedAt int64 `json:\"created_at\"`\n" +
+			"}\n\n" +
+			"// User 用户\n" +
+			"type User struct {\n" +
+			"\tBaseModel\n" +
+			"\tName   string  `json:\"name\" parameter:\"true\"` // 名称\n" +
+			"\tsecret string\n" +
+			"\tHome   Address `json:\"home\"`\n" +
+			"}\n\n" +
+			"type internal struct {\n\tId int64\n}\n",
+		"device.go": "package dto\n\n" +
+			"type Address struct {\n\tCity string `json:\"city\"`\n}\n\n" +
+			"type Device struct {\n" +
+			"\tId          int64 `json:\"id\"`\n" +
+			"\tImei, Iccid string\n" +
+			"\tOwner       *User `json:\"owner\"`\n" +
+			"}\n",
+		"device_test.go": "package dto\n\ntype Fixture struct {\n\tId int64\n}\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := loadSource("manager", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 文件按名称排序，被嵌入的结构体、做为字段类型且没有 Id 的结构体、未导出的结构体与测试文件中的结构体不做为实体
+	// 有 Id 的 User 做为 Device 的字段类型时仍然是实体
+	got := make([]string, 0, len(list))
+	for _, g := range list {
+		names := make([]string, 0, len(g.Fields))
+		for _, f := range g.Fields {
+			names = append(names, f.Name+" "+f.Type)
+		}
+		got = append(got, g.TitleName+": "+strings.Join(names, ", "))
+	}
+	want := []string{
+		"Device: Id int64, Imei string, Iccid string, Owner *User",
+		"User: Id int64, CreatedAt int64, Name string, Home Address",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected entities:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	user := list[1]
+	if user.Comment != "用户" || user.Fields[2].Comment != "名称" {
+		t.Errorf("expected comments without the name prefix, got %q and %q", user.Comment, user.Fields[2].Comment)
+	}
+	if want := filepath.Join(dir, "user.go") + ":12"; user.Fields[2].Pos != want {
+		t.Errorf("expected position %s, got %s", want, user.Fields[2].Pos)
+	}
+	if home := user.Fields[3]; !home.Object || user.Fields[0].Object {
+		t.Errorf("expected only the struct typed field Home to be a value object")
+	}
+}
+
+func TestLoadSpec(t *testing.T) {
+	list, err := loadSpecs("manager", []string{filepath.Join("testdata", "user.entity.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 位置与原始 tag 只用于检查，不影响生成的代码
+	want := sample(t)
+	list[0].Pos = ""
+	for i, f := range list[0].Fields {
+		f.Pos, f.Tag = "", want.Fields[i].Tag
+	}
+	if len(list) != 1 || !reflect.DeepEqual(list[0], want) {
+		t.Errorf("expected the same model as dto.User, got %+v", list[0])
+	}
+
+	// 字段类型与 JSON Schema 保持一致
+	var schema struct {
+		Definitions struct {
+			Field struct {
+				Properties struct {
+					Type struct {
+						AnyOf []struct {
+							Enum []string `json:"enum"`
+						} `json:"anyOf"`
+					} `json:"type"`
+				} `json:"properties"`
+			} `json:"field"`
+		} `json:"definitions"`
+	}
+	data, err := os.ReadFile("entity.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if anyOf := schema.Definitions.Field.Properties.Type.AnyOf; len(anyOf) == 0 || !reflect.DeepEqual(anyOf[0].Enum, fieldTypes) {
+		t.Errorf("entity.schema.json types %v differ from %v", anyOf, fieldTypes)
+	}
+
+	// 拼写错误的键直接报错
+	spec := filepath.Join(t.TempDir(), "user.entity.json")
+	if err = os.WriteFile(spec, []byte(`{"name": "User", "fields": [{"name": "Id", "type": "int64", "requried": true}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loadSpecs("manager", []string{spec}); err == nil || !strings.Contains(err.Error(), "requried") {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	src, list := fixture(t, "package dto\n\n"+
+		"type Device struct {\n"+
+		"\tId       int64  `json:\"id\"`\n"+
+		"\tImei     string `json:\"imei\"parameter:\"true\"`\n"+
+		"\tExpire   string `json:\"expire\" time:\"true\"`\n"+
+		"\tName     string `parameter:\"yes\"`\n"+
+		"\tRemark   string `json:\"remark\" required:\"true\"`\n"+
+		"\tSerial   string `json:\"serial\" proto:\"1\"`\n"+
+		"\tModel    string `json:\"model\" proto:\"19000\"`\n"+
+		"\tVersion  string `json:\"version\" proto:\"20\"`\n"+
+		"}\n\n"+
+		"type Log struct {\n"+
+		"\tMessage string `json:\"message\"`\n"+
+		"}\n")
+
+	var got []string
+	for _, p := range validate(list) {
+		got = append(got, strings.TrimPrefix(p.String(), src))
+	}
+	want := []string{
+		":5: Device.Imei: malformed tag `json:\"imei\"parameter:\"true\"`: missing space after json",
+		":6: Device.Expire: time field must be int64 or time.Time, got string",
+		":7: Device.Name: parameter must be true or false, got \"yes\"",
+		":7: Device.Name: missing json name",
+		":8: Device.Remark: required is only allowed on parameters, add parameter:\"true\"",
+		":9: Device.Serial: proto field number 1 is already used by Id",
+		":10: Device.Model: proto must be a field number between 1 and 536870911 except 19000-19999, got \"19000\"",
+		":14: Log: missing Id field",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected problems:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	// 指定的编号不随字段位置变化，查询请求中加上分页参数的数量
+	device := list[0]
+	version := device.Fields[len(device.Fields)-1]
+	if n := device.FieldNumber(version, 0); n != 20 {
+		t.Errorf("expected proto field number 20, got %d", n)
+	}
+	if n := device.FieldNumber(version, 2); n != 22 {
+		t.Errorf("expected proto field number 22 in list request, got %d", n)
+	}
+}
+
+func TestColumnTypes(t *testing.T) {
+	generator := newGenerator("manager", "Order")
+	generator.Fields = []*Field{
+		{Name: "Id", Type: "int64", Json: "id"},
+		{Name: "Count", Type: "uint32", Json: "count"},
+		{Name: "Amount", Type: "decimal.Decimal", Json: "amount"},
+		{Name: "Labels", Type: "map[string]string", Json: "labels"},
+		{Name: "Status", Type: "enum.Status", Json: "status"},
+		{Name: "Code", Type: "string", Json: "code", DBType: "CHAR(8)"},
+		{Name: "PaidAt", Type: "*time.Time", Json: "paid_at"},
+		{Name: "ShippedAt", Type: "int64", Json: "shipped_at", Time: "true"},
+	}
+	// 配置文件中声明的列类型优先于内置的时间类型
+	generator.Types = map[string]string{"enum.Status": "SMALLINT", "time.Time": "TIMESTAMP(3)"}
+
+	for dialect, want := range map[string][]string{
+		"postgres": {"BIGSERIAL", "BIGINT", "NUMERIC", "JSONB", "SMALLINT", "CHAR(8)", "TIMESTAMP(3)", "TIMESTAMP"},
+		"mysql":    {"BIGINT AUTO_INCREMENT", "INT UNSIGNED", "DECIMAL(20,6)", "JSON", "SMALLINT", "CHAR(8)", "TIMESTAMP(3)", "TIMESTAMP"},
+	} {
+		generator.Dialect = dialect
+		for i, f := range generator.Fields {
+			if got := generator.ColumnType(f); got != want[i] {
+				t.Errorf("%s %s: expected %s, got %s", dialect, f.Name, want[i], got)
+			}
+		}
+	}
+
+	// 未声明 import 路径的包由 validate 报错
+	var got []string
+	for _, p := range validate([]*Generate{generator}) {
+		got = append(got, p.String())
+	}
+	if want := []string{"Order.Status: unknown package enum, declare its import path in imports of generator.yaml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected problems %v, got %v", want, got)
+	}
+	generator.Packages = map[string]string{"enum": "manager/enum"}
+	if got, want := generator.Imports(), []string{"github.com/shopspring/decimal", "manager/enum"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected imports %v, got %v", want, got)
+	}
+
+	for a, b := range map[string]string{
+		"character varying(32)":       "VARCHAR(32)",
+		"int(11) unsigned":            "INT UNSIGNED",
+		"timestamp without time zone": "TIMESTAMP",
+		"tinyint(1)":                  "BOOLEAN",
+	} {
+		if canonicalType(a) != canonicalType(b) {
+			t.Errorf("expected %s to be the same type as %s", a, b)
+		}
+	}
+}
+
+func TestTimeFields(t *testing.T) {
+	generator := newGenerator("manager", "Event")
+	generator.Fields = []*Field{
+		{Name: "Id", Type: "int64", Json: "id", JsonTag: "id", Char: "`"},
+		{Name: "StartAt", Type: "time.Time", Json: "start_at", JsonTag: "start_at", Parameter: "true", Required: "true", Char: "`"},
+		{Name: "EndAt", Type: "*time.Time", Json: "end_at", JsonTag: "end_at", Parameter: "true", TimeFormat: "rfc3339", Char: "`"},
+		{Name: "RemindAt", Type: "*time.Time", Json: "remind_at", JsonTag: "remind_at", Parameter: "true", TimeFormat: "millis", Char: "`"},
+		{Name: "UpdatedAt", Type: "*time.Time", Json: "updated_at", JsonTag: "updated_at", Char: "`"},
+		{Name: "CreatedAt", Type: "*int64", Json: "created_at", JsonTag: "created_at", Char: "`"},
+	}
+	generator.TimeFormat = "unix"
+
+	for _, d := range []declaration{
+		{"model", "EventCreateRequest", "StartAt", "StartAt int64 `json:\"start_at\" validate:\"required\"`"},
+		{"model", "EventInfo", "EndAt", "EndAt *time.Time `json:\"end_at\"`"},
+		{"model", "EventInfo", "RemindAt", "RemindAt *int64 `json:\"remind_at\"`"},
+		{"model", "EventEntityToDto", "", "StartAt: e.StartAt.Unix()"},
+		{"model", "EventEntityToDto", "", "v := e.RemindAt.UnixMilli()"},
+		{"bll", "Update", "", `dict["end_at"] = *in.EndAt`},
+		{"bll", "Update", "", `dict["remind_at"] = time.UnixMilli(*in.RemindAt)`},
+		{"bll", "Update", "", `dict["updated_at"] = time.Now()`},
+		{"bll", "buildEvent", "", "StartAt: time.Unix(in.StartAt, 0)"},
+		{"bll", "buildEvent", "", "UpdatedAt: func() *time.Time { now := time.Now(); return &now }()"},
+		{"bll", "buildEvent", "", "CreatedAt: func() *int64 { now := time.Now().Unix(); return &now }()"},
+		{"postgres", "List", "", `q = q.Where("remind_at = ?", time.UnixMilli(*in.RemindAt))`},
+	} {
+		d.check(t, generator)
+	}
+	if src := rendered(t, "postgres", generator); !contains(imports(t, src), "time") {
+		t.Errorf("expected import time in postgres:\n%s", src)
+	}
+}
+
+// nestedSource 与 nestedDevice 等类型相同的 dto 源码，用于比较反射与解析源码的结果
+const nestedSource = `package dto
+
+type baseModel struct {
+	Id        int64 ` + "`json:\"id\"`" + `
+	CreatedAt int64 ` + "`json:\"created_at\"`" + `
+}
+
+type Address struct {
+	City string ` + "`json:\"city\" parameter:\"true\"`" + `
+	Zip  string ` + "`json:\"zip\"`" + `
+}
+
+type Device struct {
+	baseModel
+	Name     *string  ` + "`json:\"name\" parameter:\"true\"`" + `
+	Home     Address  ` + "`json:\"home\" parameter:\"true\"`" + `
+	Office   *Address ` + "`json:\"office\" nested:\"flatten\" prefix:\"work_\"`" + `
+	Shipping Address  ` + "`json:\"shipping\" nested:\"flatten\" parameter:\"true\" required:\"true\"`" + `
+}
+`
+
+type nestedBase struct {
+	Id        int64 `json:"id"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+type nestedAddress struct {
+	City string `json:"city" parameter:"true"`
+	Zip  string `json:"zip"`
+}
+
+type nestedDevice struct {
+	nestedBase
+	Name     *string        `json:"name" parameter:"true"`
+	Home     nestedAddress  `json:"home" parameter:"true"`
+	Office   *nestedAddress `json:"office" nested:"flatten" prefix:"work_"`
+	Shipping nestedAddress  `json:"shipping" nested:"flatten" parameter:"true" required:"true"`
+}
+
+func TestNestedFields(t *testing.T) {
+	_, list := fixture(t, nestedSource)
+	// Address 做为字段类型，不单独做为实体
+	if len(list) != 1 || list[0].TitleName != "Device" {
+		t.Fatalf("expected only Device, got %d entities", len(list))
+	}
+	reflected, err := newGenerate("manager", nestedDevice{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 外层的 parameter、required 应用到展开后没有设置这两个 tag 的字段上
+	want := []string{
+		"Id int64 id", "CreatedAt int64 created_at", "Name *string name parameter", "Home Address home parameter object",
+		"OfficeCity string work_city parameter", "OfficeZip string work_zip",
+		"ShippingCity string shipping_city parameter required", "ShippingZip string shipping_zip parameter required",
+	}
+	for _, generator := range []*Generate{list[0], reflected} {
+		got := make([]string, 0, len(generator.Fields))
+		for _, f := range generator.Fields {
+			s := strings.Join([]string{f.Name, f.Type, f.Json}, " ")
+			if f.IsParameter() {
+				s += " parameter"
+			}
+			if f.IsRequired() {
+				s += " required"
+			}
+			if f.Object {
+				s += " object"
+			}
+			got = append(got, strings.Replace(s, "nestedAddress", "Address", 1))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected fields:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+		}
+	}
+
+	generator := list[0]
+	if problems := validate(list); len(problems) != 0 {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+	for _, d := range []declaration{
+		{"entity", "Device", "Name", "Name *string `gorm:\"column:name;type:VARCHAR(255)\" json:\"name\"`"},
+		{"entity", "Device", "Home", "Home po.Address `gorm:\"column:home;type:JSON;serializer:json\" json:\"home\"`"},
+		{"entity", "Device", "ShippingCity", "ShippingCity string `gorm:\"column:shipping_city;type:VARCHAR(255)\" json:\"shipping_city\"`"},
+	} {
+		d.check(t, generator)
+	}
+	if src := rendered(t, "entity", generator); !contains(imports(t, src), "manager/model/po") {
+		t.Errorf("expected import manager/model/po in entity:\n%s", src)
+	}
+	if src := rendered(t, "postgres", generator); bytes.Contains(src, []byte(`"home`)) {
+		t.Errorf("value object should not be used as a filter:\n%s", src)
+	}
+}
+
+func TestRelations(t *testing.T) {
+	_, list := fixture(t, "package dto\n\n"+
+		"type User struct {\n"+
+		"\tId      int64    `json:\"id\"`\n"+
+		"\tDevices []Device `json:\"devices\" rel:\"has_many:Device\"`\n"+
+		"\tRoles   []Role   `json:\"roles\" rel:\"many_to_many:Role\"`\n"+
+		"}\n\n"+
+		"type Device struct {\n"+
+		"\tId     int64 `json:\"id\"`\n"+
+		"\tUserId int64 `json:\"user_id\" parameter:\"true\" required:\"true\" rel:\"belongs_to:User\"`\n"+
+		"}\n\n"+
+		"type Role struct {\n"+
+		"\tId    int64 `json:\"id\"`\n"+
+		"\tUsers []User `json:\"users\" rel:\"has_many:User\"`\n"+
+		"\tOwner int64 `json:\"owner\" rel:\"belongs_to:Group\"`\n"+
+		"}\n")
+
+	var got []string
+	for _, p := range validate(list) {
+		got = append(got, p.String()[strings.Index(p.String(), ": ")+2:])
+	}
+	want := []string{
+		"Role.Users: has_many requires int64 field RoleId in User",
+		"Role.Owner: rel refers to unknown entity Group",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected problems:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	user, device := list[0], list[1]
+	if len(user.Fields) != 1 || len(user.Relations) != 2 {
+		t.Fatalf("expected has_many and many_to_many fields to become relations, got %d fields", len(user.Fields))
+	}
+	if col := device.Columns()[1]; !col.Index {
+		t.Errorf("expected index on foreign key %s", col.Name)
+	}
+	for _, c := range []struct {
+		generator *Generate
+		declaration
+	}{
+		{user, declaration{"entity", "User", "Devices", "Devices []*Device `gorm:\"foreignKey:UserId\" json:\"devices,omitempty\"`"}},
+		{user, declaration{"entity", "User", "Roles", "Roles []*Role `gorm:\"many2many:user_roles\" json:\"roles,omitempty\"`"}},
+		{device, declaration{"entity", "Device", "User", "User *User `gorm:\"foreignKey:UserId\" json:\"user,omitempty\"`"}},
+		{device, declaration{"model", "DeviceListRequest", "UserId", "UserId *int64 `json:\"user_id\"`"}},
+		{device, declaration{"model", "DeviceInfoRequest", "With", "With []string `json:\"with\" validate:\"omitempty,dive,oneof=user\"`"}},
+		{device, declaration{"model", "DeviceInfo", "User", "User *UserInfo `json:\"user,omitempty\"`"}},
+		{device, declaration{"model", "DeviceEntityToDto", "", "out.User = UserEntityToDto(e.User)"}},
+		{user, declaration{"model", "UserEntityToDto", "", "out.Devices = DevicesEntityToDto(e.Devices)"}},
+		{device, declaration{"postgres", "List", "", `q = q.Where("user_id = ?", in.UserId)`}},
+		{device, declaration{"postgres", "preloadDevice", "", `q = q.Preload("User")`}},
+	} {
+		c.check(t, c.generator)
+	}
+
+	// RESTful 的详情只有路径中的 id，with 需要从查询参数中读取
+	device.Route = "rest"
+	for framework, want := range map[string]string{
+		"gin":      "err = c.ShouldBindQuery(in)",
+		"chi":      "err = utils.BindQuery(r, in)",
+		"net/http": "err = utils.BindQuery(r, in)",
+	} {
+		device.Framework = framework
+		src := rendered(t, frameworks[framework], device)
+		if !contains(statements(t, src, "find"), want) {
+			t.Errorf("%s: expected %s in find:\n%s", framework, want, funcDecl(t, src, "find"))
+		}
+	}
+
+	// 文档中的 with 与 handler 的绑定方式一致，使用重复的查询参数 with=user&with=...
+	doc, err := execute(builtin(t, "openapi"), device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var api struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name    string
+				In      string
+				Explode *bool
+			}
+		}
+	}
+	if err = yaml.Unmarshal(doc, &api); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/devices", "/devices/{id}"} {
+		found := false
+		for _, param := range api.Paths[path]["get"].Parameters {
+			if param.Name == "with" {
+				found = param.In == "query" && param.Explode != nil && *param.Explode
+			}
+		}
+		if !found {
+			t.Errorf("expected exploded with query parameter in GET %s:\n%s", path, doc)
+		}
+	}
+}
+
+func TestAssociations(t *testing.T) {
+	_, list := fixture(t, "package dto\n\n"+
+		"type User struct {\n"+
+		"\tId    int64  `json:\"id\"`\n"+
+		"\tRoles []Role `json:\"roles\" rel:\"many_to_many:Role\"`\n"+
+		"}\n\n"+
+		"type Role struct {\n"+
+		"\tId      int64  `json:\"id\"`\n"+
+		"\tUsers   []User `json:\"users\" rel:\"many_to_many:User:user_roles\"`\n"+
+		"\tParents []Role `json:\"parents\" rel:\"many_to_many:Role\"`\n"+
+		"}\n")
+	(&options{Dialect: "postgres"}).apply(list)
+
+	var got []string
+	for _, p := range validate(list) {
+		got = append(got, p.String()[strings.Index(p.String(), ": ")+2:])
+	}
+	want := []string{"Role.Parents: many_to_many between Role and itself is not supported"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected problems:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	user, role := list[0], list[1]
+	joins := user.Joins()
+	if len(joins) != 1 || role.Relations[0].Join != joins[0] || !role.Relations[0].Inverse {
+		t.Fatalf("expected user_roles to be shared by both sides, got %d joins", len(joins))
+	}
+	join := joins[0]
+	if join.Version == user.Version || join.Version == role.Version {
+		t.Errorf("expected a separate migration version for %s, got %s", join.Table(), join.Version)
+	}
+
+	up, err := execute(builtin(t, "migration").Lookup("up"), join)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`CREATE TABLE IF NOT EXISTS "user_roles" (`,
+		`"user_id" BIGINT NOT NULL,`,
+		`PRIMARY KEY ("user_id", "role_id")`,
+		`CREATE INDEX IF NOT EXISTS "idx_user_roles_role_id" ON "user_roles" ("role_id");`,
+	} {
+		if !bytes.Contains(up, []byte(line)) {
+			t.Errorf("migration: expected %s in output:\n%s", line, up)
+		}
+	}
+
+	for _, c := range []struct {
+		generator *Generate
+		declaration
+	}{
+		{user, declaration{"entity", "UserRole", "RoleId", "RoleId int64 `gorm:\"column:role_id;type:BIGINT;primary_key\" json:\"role_id\"`"}},
+		{user, declaration{"entity", "UserRole.TableName", "", `return "user_roles"`}},
+		{user, declaration{"store", "IUser", "ReplaceRoles", "ReplaceRoles(ctx context.Context, id int64, roleIds []int64) error"}},
+		{user, declaration{"postgres", "RemoveRoles", "", `GetDB(ctx).Where("user_id = ? AND role_id IN ?", id, roleIds).Delete(&entity.UserRole{})`}},
+		{user, declaration{"postgres", "addUserRoles", "", "rows = append(rows, &entity.UserRole{UserId: id, RoleId: v})"}},
+		{role, declaration{"postgres", "addRoleUsers", "", "rows = append(rows, &entity.UserRole{RoleId: id, UserId: v})"}},
+		{user, declaration{"model", "UserRolesRequest", "RoleIds", "RoleIds []int64 `json:\"role_ids\"`"}},
+		{user, declaration{"bll", "RemoveRoles", "", "return a.iUser.RemoveRoles(ctx, in.Id, in.RoleIds)"}},
+		{user, declaration{"api", "Init", "", `g.POST("/roles/add", a.addRoles)`}},
+		{user, declaration{"api", "replaceRoles", "", "bll.User.ReplaceRoles(c.Request.Context(), in)"}},
+	} {
+		c.check(t, c.generator)
+	}
+	if src := rendered(t, "postgres", user); !contains(imports(t, src), "gorm.io/gorm/clause") {
+		t.Errorf("expected import gorm.io/gorm/clause in postgres:\n%s", src)
+	}
+	if src := rendered(t, "entity", role); bytes.Contains(src, []byte("type UserRole")) {
+		t.Errorf("expected the inverse side not to declare the join entity:\n%s", src)
+	}
+
+	user.Route = "rest"
+	(&declaration{"api", "Init", "", `g.DELETE("/:id/roles", a.removeRoles)`}).check(t, user)
+}
+
+func TestGenConflict(t *testing.T) {
+	root := t.TempDir()
+	o, err := parseFlags("gen", []string{"-project", "manager", "-out", root, "-input", filepath.Join("testdata", "user.entity.yaml"), "-layer", "model"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = runGen(o, io.Discard); exitCode(err) != 0 {
+		t.Fatal(err)
+	}
+
+	// 生成结果与手工修改改动了同一行
+	l := o.Layers[0]
+	filename, baseline := layerPath(root, l, sample(t), ""), baselinePath(root, l, sample(t), "")
+	for path, comment := range map[string]string{filename: "// 手工修改", baseline: "// 上次生成"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = bytes.Replace(data, []byte("// UserCreateRequest"), []byte(comment), 1)
+		if err = os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = runGen(o, io.Discard)
+	if !errors.Is(err, errConflict) || exitCode(err) != 3 {
+		t.Fatalf("expected merge conflicts with exit code 3, got %v", err)
+	}
+	if exitCode(errOutdated) != 1 || exitCode(errors.New("template error")) != 2 {
+		t.Errorf("expected exit codes 1 and 2 to be kept for outdated code and failures")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(from, to int, replace map[int]string) string {
+		var b strings.Builder
+		for i := from; i <= to; i++ {
+			if text, ok := replace[i]; ok {
+				b.WriteString(text + "\n")
+				continue
+			}
+			fmt.Fprintf(&b, "%d\n", i)
+		}
+		return b.String()
+	}
+	for _, c := range []struct {
+		name     string
+		old, new string
+		want     []string // 依次出现的 hunk 头
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", nil},
+		{"change", lines(1, 9, nil), lines(1, 9, map[int]string{5: "x"}), []string{"@@ -2,7 +2,7 @@"}},
+		{"create", "", "a\nb\n", []string{"@@ -0,0 +1,2 @@"}},
+		{"remove", "a\n", "", []string{"@@ -1 +0,0 @@"}},
+		{"append", "a\n", "a\nb\n", []string{"@@ -1 +1,2 @@"}},
+		{"separate hunks", lines(1, 20, nil), lines(1, 20, map[int]string{2: "x", 18: "y"}), []string{"@@ -1,5 +1,5 @@", "@@ -15,6 +15,6 @@"}},
+		{"merged hunk", lines(1, 20, nil), lines(1, 20, map[int]string{2: "x", 8: "y"}), []string{"@@ -1,11 +1,11 @@"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			diff := unifiedDiff("a/file", "b/file", []byte(c.old), []byte(c.new))
+			if c.want == nil {
+				if diff != "" {
+					t.Errorf("expected no diff, got:\n%s", diff)
+				}
+				return
+			}
+			if !strings.HasPrefix(diff, "--- a/file\n+++ b/file\n") {
+				t.Errorf("expected file headers, got:\n%s", diff)
+			}
+			var hunks []string
+			for _, line := range strings.Split(diff, "\n") {
+				if strings.HasPrefix(line, "@@") {
+					hunks = append(hunks, line)
+				}
+			}
+			if strings.Join(hunks, "|") != strings.Join(c.want, "|") {
+				t.Errorf("expected hunks %q, got %q:\n%s", c.want, hunks, diff)
+			}
+		})
+	}
+
+	diff := unifiedDiff("a", "b", []byte("a\n"), []byte("a"))
+	if want := "@@ -1 +1 @@\n-a\n+a\n\\ No newline at end of file\n"; !strings.HasSuffix(diff, want) {
+		t.Errorf("expected missing newline marker, got:\n%s", diff)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	root := t.TempDir()
+	args := []string{"-project", "manager", "-out", root, "-input", filepath.Join("testdata", "user.entity.yaml"), "-layer", "model,migration"}
+	o, err := parseFlags("gen", append(args, "-dry-run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err = runGen(o, &out); !errors.Is(err, errOutdated) {
+		t.Fatalf("expected outdated files, got %v", err)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) > 0 {
+		t.Errorf("expected dry run to write nothing, found %d entries", len(entries))
+	}
+	// 表结构快照等内部状态文件不出现在预览中
+	if strings.Contains(out.String(), stateDir) {
+		t.Errorf("expected no internal state files in output:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "+++ b/model/user.go") {
+		t.Errorf("expected the model to be listed:\n%s", out.String())
+	}
+
+	if o, err = parseFlags("gen", args); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err = runGen(o, &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), stateDir) {
+		t.Errorf("expected no internal state files in output:\n%s", out.String())
+	}
+
+	if o, err = parseFlags("diff", args); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err = runDiff(o, &out); err != nil {
+		t.Fatalf("expected no changes after gen, got %v:\n%s", err, out.String())
+	}
+	if strings.Contains(out.String(), stateDir) || !strings.Contains(out.String(), "0 created, 0 changed") {
+		t.Errorf("expected an empty diff:\n%s", out.String())
+	}
+}
+
+func TestClean(t *testing.T) {
+	var (
+		root  = t.TempDir()
+		input = filepath.Join("testdata", "user.entity.yaml")
+		args  = []string{"-project", "manager", "-out", root, "-input", input, "-layer", "model,entity,migration"}
+	)
+	o, err := parseFlags("gen", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = runGen(o, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	model := filepath.Join(root, "model", "user.go")
+	data, err := os.ReadFile(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(model, append(data, "\n// 手工修改\n"...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	migrations, _ := filepath.Glob(filepath.Join(root, "migrations", "*"))
+
+	// 默认只删除未修改过的文件，迁移文件与快照保留
+	if o, err = parseFlags("clean", args); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err = runClean(o, &out); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(filepath.Join(root, "model", "entity", "user.go")) {
+		t.Errorf("expected the unmodified entity to be removed:\n%s", out.String())
+	}
+	for _, filename := range append(migrations, model, schemaPath(root, sample(t))) {
+		if !fileExists(filename) {
+			t.Errorf("expected %s to be kept:\n%s", filename, out.String())
+		}
+	}
+
+	if o, err = parseFlags("clean", append(args, "-force")); err != nil {
+		t.Fatal(err)
+	}
+	if err = runClean(o, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range append(migrations, model, schemaPath(root, sample(t))) {
+		if fileExists(filename) {
+			t.Errorf("expected %s to be removed with -force", filename)
+		}
+	}
+}
+
+func TestModulePath(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		want string
+	}{
+		{"module example.com/manager\n\ngo 1.21\n", "example.com/manager"},
+		{"module example.com/manager // 注释\n", "example.com/manager"},
+		{"module \"example.com/manager\"\n", "example.com/manager"},
+		{"module `example.com/manager`\n", "example.com/manager"},
+		{"// module example.com/old\n\n  module example.com/manager\n", "example.com/manager"},
+		{"go 1.21\n\nrequire example.com/module v1.0.0\n", ""},
+	} {
+		if got := modulePath([]byte(c.src)); got != c.want {
+			t.Errorf("%q: expected %q, got %q", c.src, c.want, got)
+		}
+	}
+
+	// 使用最近的 go.mod，嵌套的模块不受外层模块影响
+	root := t.TempDir()
+	nested := filepath.Join(root, "tools", "generator")
+	for dir, src := range map[string]string{root: "module example.com/manager\n", nested: "module example.com/manager/tools/generator\n"} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for dir, want := range map[string]string{
+		filepath.Join(root, "tools"): "example.com/manager",
+		filepath.Join(nested, "dto"): "example.com/manager/tools/generator",
+	} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := findModule(dir); err != nil || got != want {
+			t.Errorf("%s: expected %s, got %q (%v)", dir, want, got, err)
+		}
+	}
+}
+
+func TestConfigFramework(t *testing.T) {
+	for _, c := range []struct {
+		template string
+		want     string
+	}{
+		{"", "api_echo.tmpl"},
+		{"api", "api_echo.tmpl"},
+		{"api.tmpl", "api_echo.tmpl"},
+		{"api_chi", "api_chi.tmpl"},
+	} {
+		cfg := &Config{Framework: "echo", Layers: map[string]*Layer{"api": {Template: c.template}}}
+		list, err := cfg.layers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := list[0].Template.Name(); got != c.want {
+			t.Errorf("template %q: expected %s, got %s", c.template, c.want, got)
+		}
+	}
+
+	// 示例配置中的 template 不能覆盖 framework
+	cfg, err := loadConfig("generator.example.yaml", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Framework = "chi"
+	list, err := cfg.layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := list[0].Template.Name(); got != "api_chi.tmpl" {
+		t.Errorf("example config: expected api_chi.tmpl, got %s", got)
+	}
+}
+
+func TestFindRegions(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		src  string
+		want string // 区域名称与起止行，或错误信息
+	}{
+		{"pairs", "a\n// generator:begin fields\nb\n// generator:end fields\n\t// generator:begin custom\n\t// generator:end custom\n", "fields 1-3, custom 4-5"},
+		{"nested", "// generator:begin a\n// generator:begin b\n// generator:end b\n// generator:end a\n", "line 2: region b begins inside region a"},
+		{"unterminated", "x\n// generator:begin custom\n", "line 2: region custom is not closed"},
+		{"end without begin", "// generator:end custom\n", "line 1: unexpected end of region custom"},
+		{"mismatched end", "// generator:begin a\n// generator:end b\n", "line 2: unexpected end of region b"},
+		{"duplicate", "// generator:begin a\n// generator:end a\n// generator:begin a\n// generator:end a\n", "line 3: duplicate region a"},
+	} {
+		var got string
+		list, err := findRegions(splitLines([]byte(c.src)))
+		if err != nil {
+			got = err.Error()
+		}
+		for i, r := range list {
+			if i > 0 {
+				got += ", "
+			}
+			got += fmt.Sprintf("%s %d-%d", r.Name, r.Begin, r.End)
+		}
+		if got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestKeepRegions(t *testing.T) {
+	const generated = "package a\n\n// generator:begin custom\n// generator:end custom\n"
+	for _, c := range []struct {
+		name string
+		src  string // 新生成的内容
+		old  string // 磁盘上的文件
+		want string // 合并结果或错误信息
+	}{
+		{
+			"keep content",
+			"package a\n\nfunc b() {}\n\n// generator:begin custom\n// generator:end custom\n",
+			"package a\n\n// generator:begin custom\n\tfunc c() {}\n// generator:end custom\n",
+			"package a\n\nfunc b() {}\n\n// generator:begin custom\n\tfunc c() {}\n// generator:end custom\n",
+		},
+		{
+			"new region stays empty",
+			"// generator:begin fields\n// generator:end fields\n" + generated,
+			generated,
+			"// generator:begin fields\n// generator:end fields\n" + generated,
+		},
+		{
+			"removed empty region",
+			generated,
+			"// generator:begin fields\n// generator:end fields\n" + generated,
+			generated,
+		},
+		{
+			"renamed region with content",
+			"// generator:begin extra\n// generator:end extra\n",
+			"// generator:begin custom\nfunc c() {}\n// generator:end custom\n",
+			"region custom no longer exists in generated code, move its content first",
+		},
+		{
+			"broken existing file",
+			generated,
+			"// generator:begin custom\n",
+			"existing file: line 1: region custom is not closed",
+		},
+	} {
+		src, err := keepRegions([]byte(c.src), []byte(c.old))
+		got := string(src)
+		if err != nil {
+			got = err.Error()
+		}
+		if got != c.want {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", c.name, c.want, got)
+		}
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	const base = "a\nb\nc\nd\ne\n"
+	for _, c := range []struct {
+		name      string
+		mine      string
+		theirs    string
+		want      string
+		conflicts int
+	}{
+		{"clean", "a\nB\nc\nd\ne\n", "a\nb\nc\nD\ne\n", "a\nB\nc\nD\ne\n", 0},
+		{"same change", "a\nB\nc\nd\ne\n", "a\nB\nc\nd\ne\n", "a\nB\nc\nd\ne\n", 0},
+		{"delete", "a\nb\nd\ne\n", "a\nb\nc\nd\nE\n", "a\nb\nd\nE\n", 0},
+		{"insert at start", "h\na\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "h\na\nb\nc\nd\nE\n", 0},
+		{"append at end", "a\nb\nc\nd\ne\nz", "A\nb\nc\nd\ne\n", "A\nb\nc\nd\ne\nz", 0},
+		{
+			"overlap", "a\nb\nX\nd\ne\n", "a\nb\nY\nd\ne\n",
+			"a\nb\n<<<<<<< current\nX\n=======\nY\n>>>>>>> generated\nd\ne\n", 1,
+		},
+		{
+			"overlap at end without newline", "a\nb\nc\nd\ne\nz", "a\nb\nc\nd\nE\n",
+			"a\nb\nc\nd\n<<<<<<< current\ne\nz\n=======\nE\n>>>>>>> generated\n", 1,
+		},
+	} {
+		got, conflicts := merge3([]byte(base), []byte(c.mine), []byte(c.theirs))
+		if string(got) != c.want || conflicts != c.conflicts {
+			t.Errorf("%s: expected %d conflict(s):\n%s\ngot %d:\n%s", c.name, c.conflicts, c.want, conflicts, got)
+		}
+		if hasConflicts(got) != (c.conflicts > 0) {
+			t.Errorf("%s: hasConflicts should be %v", c.name, c.conflicts > 0)
+		}
+	}
+
+	for _, c := range []struct {
+		a, b string
+		want [][2]int
+	}{
+		{"abc", "bcd", [][2]int{{1, 0}, {2, 1}}},
+		{"abc", "", [][2]int{}},
+		{"axbyc", "abc", [][2]int{{0, 0}, {2, 1}, {4, 2}}},
+	} {
+		if got := lcs(strings.Split(c.a, ""), strings.Split(c.b, "")); len(got)+len(c.want) > 0 && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("lcs(%q, %q): expected %v, got %v", c.a, c.b, c.want, got)
+		}
+	}
+}
+
+func TestRemoveOpenAPI(t *testing.T) {
+	var (
+		err  error
+		doc  []byte
+		docs = make(map[string][]byte)
+		p    = builtin(t, "openapi")
+	)
+	// UserRole 的组件名称以 User 开头，删除 User 时不能受影响
+	for _, name := range []string{"User", "UserRole"} {
+		generator := sample(t)
+		if name != generator.TitleName {
+			generator = newGenerator("manager", name)
+			generator.Fields = sample(t).Fields
+		}
+		src, err := execute(p, generator)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if docs[name], err = formatYAML(src); err != nil {
+			t.Fatal(err)
+		}
+		if doc, err = mergeOpenAPI(doc, docs[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if doc, err = removeOpenAPI(doc, docs["User"]); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Paths      map[string]interface{}
+		Components struct{ Schemas map[string]interface{} }
+	}
+	if err = yaml.Unmarshal(doc, &got); err != nil {
+		t.Fatal(err)
+	}
+	var paths, schemas []string
+	for name := range got.Paths {
+		paths = append(paths, name)
+	}
+	for name := range got.Components.Schemas {
+		schemas = append(schemas, name)
+	}
+	sort.Strings(paths)
+	sort.Strings(schemas)
+	want := []string{"Response", "UserRoleCreateRequest", "UserRoleDeleteRequest", "UserRoleInfo", "UserRoleInfoRequest", "UserRoleListRequest", "UserRoleListResponse", "UserRoleUpdateRequest"}
+	if !reflect.DeepEqual(schemas, want) {
+		t.Errorf("expected schemas %v, got %v", want, schemas)
+	}
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/userRole/") {
+			t.Errorf("expected only UserRole paths, got %s", path)
+		}
+	}
+	if len(paths) == 0 {
+		t.Errorf("expected UserRole paths to be kept:\n%s", doc)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import "strings"
+
+// 冲突标记，与 git 保持一致
+const (
+	conflictMine   = "<<<<<<< current\n"
+	conflictSep    = "=======\n"
+	conflictTheirs = ">>>>>>> generated\n"
+)
+
+// lcs 使用 Myers 算法计算两组行的最长公共子序列，返回匹配行的下标
+func lcs(a, b []string) [][2]int {
+	var (
+		n     = len(a)
+		m     = len(b)
+		max   = n + m
+		v     = make([]int, 2*max+2)
+		trace = make([][]int, 0)
+	)
+
+	// 正向搜索，记录每一步的 V 以便回溯
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, max, d)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack 根据搜索记录回溯出匹配的行
+func backtrack(trace [][]int, a, b []string, max, depth int) [][2]int {
+	var (
+		x       = len(a)
+		y       = len(b)
+		matches = make([][2]int, 0)
+	)
+	for d := depth; d > 0; d-- {
+		var (
+			v    = trace[d]
+			k    = x - y
+			prev = k - 1
+		)
+		if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+			prev = k + 1
+		}
+		prevX := v[max+prev]
+		prevY := prevX - prev
+		for x > prevX && y > prevY {
+			x--
+			y--
+			matches = append(matches, [2]int{x, y})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		matches = append(matches, [2]int{x, y})
+	}
+
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches
+}
+
+// merge3 以 base 为共同祖先，合并 mine（手工修改后的文件）与 theirs（新生成的文件）
+// 双方修改同一处且内容不同时写入冲突标记，返回合并结果与冲突数量
+func merge3(base, mine, theirs []byte) ([]byte, int) {
+	var (
+		o = splitLines(base)
+		a = splitLines(mine)
+		b = splitLines(theirs)
+
+		inA = make(map[int]int)
+		inB = make(map[int]int)
+
+		buf       strings.Builder
+		conflicts int
+		i, j, k   int
+	)
+	for _, p := range lcs(o, a) {
+		inA[p[0]] = p[1]
+	}
+	for _, p := range lcs(o, b) {
+		inB[p[0]] = p[1]
+	}
+
+	resolve := func(co, ca, cb []string) {
+		switch {
+		case equalLines(co, ca):
+			buf.WriteString(strings.Join(cb, ""))
+		case equalLines(co, cb), equalLines(ca, cb):
+			buf.WriteString(strings.Join(ca, ""))
+		default:
+			conflicts++
+			buf.WriteString(conflictMine)
+			buf.WriteString(strings.Join(ensureNewline(ca), ""))
+			buf.WriteString(conflictSep)
+			buf.WriteString(strings.Join(ensureNewline(cb), ""))
+			buf.WriteString(conflictTheirs)
+		}
+	}
+
+	for {
+		// 查找下一个三方都相同的行
+		s := i
+		for s < len(o) {
+			_, okA := inA[s]
+			_, okB := inB[s]
+			if okA && okB {
+				break
+			}
+			s++
+		}
+		if s == len(o) {
+			resolve(o[i:], a[j:], b[k:])
+			break
+		}
+
+		resolve(o[i:s], a[j:inA[s]], b[k:inB[s]])
+		buf.WriteString(o[s])
+		i, j, k = s+1, inA[s]+1, inB[s]+1
+	}
+	return []byte(buf.String()), conflicts
+}
+
+// hasConflicts 内容中是否包含未解决的冲突标记
+func hasConflicts(src []byte) bool {
+	for _, line := range splitLines(src) {
+		if line == conflictMine || line == conflictTheirs {
+			return true
+		}
+	}
+	return false
+}
+
+// equalLines 判断两组行是否完全相同
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ensureNewline 保证冲突块的最后一行以换行结尾，避免与冲突标记连在一起
+func ensureNewline(lines []string) []string {
+	if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		out := append([]string{}, lines...)
+		out[n-1] += "\n"
+		return out
+	}
+	return lines
+}
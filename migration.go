@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Schema 表结构，每次生成迁移文件后保存在 .generator/schema 中，用于生成增量迁移
+type Schema struct {
+	Dialect string    `json:"dialect"`
+	Table   string    `json:"table"`
+	Comment string    `json:"comment,omitempty"`
+	Columns []*Column `json:"columns"`
+}
+
+// Column 列结构
+type Column struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Primary bool   `json:"primary,omitempty"`
+	NotNull bool   `json:"not_null,omitempty"`
+	Default string `json:"default,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	Index   bool   `json:"index,omitempty"`
+	Unique  bool   `json:"unique,omitempty"`
+}
+
+// Change 列变更
+type Change struct {
+	Kind   string  // add、drop、modify、add_index、drop_index
+	Column *Column // 变更后的列，drop 与 drop_index 时为删除前的列
+	Old    *Column // 变更前的列，仅 modify 时存在
+}
+
+// dialects 可选的数据库方言
+var dialects = []string{"postgres", "mysql"}
+
+// Table 实体对应的表名，与 entity 中的 TableName 一致，从 DDL 生成时沿用 DDL 中的表名
+func (g *Generate) Table() string {
+	if g.TableName != "" {
+		return g.TableName
+	}
+	return g.FileName + "s"
+}
+
+// IsMySQL 是否使用 MySQL 方言
+func (g *Generate) IsMySQL() bool {
+	return g.Dialect == "mysql"
+}
+
+// Columns 实体对应的列
+func (g *Generate) Columns() []*Column {
+	columns := make([]*Column, 0, len(g.Fields))
+	for _, f := range g.Fields {
+		columns = append(columns, &Column{
+			Name:    f.JsonName(),
+			Type:    g.ColumnType(f),
+			Primary: f.IsID() || f.Primary,
+			NotNull: f.IsID() || f.Primary || f.IsRequired() && !f.IsNullable(),
+			Default: f.SQLDefault(),
+			Comment: f.Comment,
+			Index:   f.IsIndex() || f.IsForeignKey() && !f.IsUnique(),
+			Unique:  f.IsUnique(),
+		})
+	}
+	return columns
+}
+
+// Schema 实体对应的表结构
+func (g *Generate) Schema() *Schema {
+	dialect := g.Dialect
+	if dialect == "" {
+		dialect = "postgres"
+	}
+	return &Schema{Dialect: dialect, Table: g.Table(), Comment: g.Comment, Columns: g.Columns()}
+}
+
+// PrimaryKey 主键中的列，以逗号分隔，中间表为两个外键组成的联合主键
+func (g *Generate) PrimaryKey() string {
+	names := make([]string, 0, 1)
+	for _, c := range g.Columns() {
+		if c.Primary {
+			names = append(names, g.Ident(c.Name))
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// ColumnDef 列定义，包含类型、非空约束、默认值，MySQL 中同时包含注释
+func (g *Generate) ColumnDef(c *Column) string {
+	def := c.Type
+	if c.NotNull {
+		def += " NOT NULL"
+	}
+	if c.Default != "" {
+		def += " DEFAULT " + c.Default
+	}
+	if g.IsMySQL() && c.Comment != "" {
+		def += " COMMENT " + g.Quote(c.Comment)
+	}
+	return def
+}
+
+// IndexName 列上索引的名称，唯一索引为 uk_<table>_<column>，普通索引为 idx_<table>_<column>
+func (g *Generate) IndexName(c *Column) string {
+	if c.Unique {
+		return "uk_" + g.Table() + "_" + c.Name
+	}
+	return "idx_" + g.Table() + "_" + c.Name
+}
+
+// Revert 返回变更反向执行的生成模型，用于生成 down 迁移
+func (g *Generate) Revert() *Generate {
+	out := *g
+	out.Changes = make([]*Change, 0, len(g.Changes))
+	for i := len(g.Changes) - 1; i >= 0; i-- {
+		c := g.Changes[i]
+		switch c.Kind {
+		case "add":
+			out.Changes = append(out.Changes, &Change{Kind: "drop", Column: c.Column})
+		case "drop":
+			out.Changes = append(out.Changes, &Change{Kind: "add", Column: c.Column})
+		case "add_index":
+			out.Changes = append(out.Changes, &Change{Kind: "drop_index", Column: c.Column})
+		case "drop_index":
+			out.Changes = append(out.Changes, &Change{Kind: "add_index", Column: c.Column})
+		case "modify":
+			out.Changes = append(out.Changes, &Change{Kind: "modify", Column: c.Old, Old: c.Column})
+		}
+	}
+	return &out
+}
+
+// Destructive 是否为可能丢失数据的变更
+func (c *Change) Destructive() bool {
+	return c.Kind == "drop" || (c.Kind == "modify" && c.Old.Type != c.Column.Type)
+}
+
+// String 变更描述
+func (c *Change) String() string {
+	if c.Kind == "modify" && c.Old.Type != c.Column.Type {
+		return fmt.Sprintf("modify %s %s => %s", c.Column.Name, c.Old.Type, c.Column.Type)
+	}
+	return c.Kind + " " + c.Column.Name
+}
+
+// diffSchema 比较两次的表结构，返回列与索引的变更
+func diffSchema(old, current *Schema) []*Change {
+	var (
+		changes = make([]*Change, 0)
+		before  = make(map[string]*Column)
+		after   = make(map[string]*Column)
+	)
+	for _, c := range old.Columns {
+		before[c.Name] = c
+	}
+	for _, c := range current.Columns {
+		after[c.Name] = c
+	}
+
+	for _, c := range old.Columns {
+		if _, ok := after[c.Name]; ok {
+			continue
+		}
+		if c.Index || c.Unique {
+			changes = append(changes, &Change{Kind: "drop_index", Column: c})
+		}
+		changes = append(changes, &Change{Kind: "drop", Column: c})
+	}
+	for _, c := range current.Columns {
+		o, ok := before[c.Name]
+		if !ok {
+			changes = append(changes, &Change{Kind: "add", Column: c})
+			if c.Index || c.Unique {
+				changes = append(changes, &Change{Kind: "add_index", Column: c})
+			}
+			continue
+		}
+		if o.Type != c.Type || o.NotNull != c.NotNull || o.Default != c.Default || o.Comment != c.Comment {
+			changes = append(changes, &Change{Kind: "modify", Column: c, Old: o})
+		}
+		if o.Index != c.Index || o.Unique != c.Unique {
+			if o.Index || o.Unique {
+				changes = append(changes, &Change{Kind: "drop_index", Column: o})
+			}
+			if c.Index || c.Unique {
+				changes = append(changes, &Change{Kind: "add_index", Column: c})
+			}
+		}
+	}
+	return changes
+}
+
+// schemaPath 表结构快照的存放路径
+func schemaPath(root string, generator *Generate) string {
+	return filepath.Join(root, stateDir, "schema", generator.Table()+".json")
+}
+
+// loadSchema 读取表结构快照，不存在时返回 nil
+func loadSchema(filename string) (*Schema, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	schema := &Schema{}
+	if err = json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return schema, nil
+}
+
+// renderMigrations 渲染实体及其 many_to_many 中间表的迁移文件
+func renderMigrations(root string, generator *Generate, l *layer) ([]*output, error) {
+	list := make([]*output, 0)
+	for _, g := range append([]*Generate{generator}, generator.Joins()...) {
+		files, err := renderMigration(root, g, l)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, files...)
+	}
+	return list, nil
+}
+
+// renderMigration 渲染迁移文件
+//   - 建表的迁移文件不存在时生成建表语句
+//   - 已存在时与上次保存的表结构比较，有变更时生成新的 ALTER TABLE 迁移，已有的迁移文件不会再修改
+//   - 删除列、修改列类型等破坏性的变更需要显式允许
+func renderMigration(root string, generator *Generate, l *layer) ([]*output, error) {
+	var (
+		err      error
+		data     []byte
+		old      *Schema
+		files    []*output
+		current  = generator.Schema()
+		filename = schemaPath(root, generator)
+		created  = fileExists(layerPath(root, l, generator, l.parts()[0]))
+	)
+	if data, err = json.MarshalIndent(current, "", "  "); err != nil {
+		return nil, err
+	}
+	data = append(data, '\n')
+	snapshot := &output{Layer: l.Name, Path: filename, Src: data, Merge: replaceWith(data)}
+
+	if old, err = loadSchema(filename); err != nil {
+		return nil, err
+	}
+	switch {
+	case !created:
+		if files, err = renderLayer(root, generator, l); err != nil {
+			return nil, err
+		}
+		return append(files, snapshot), nil
+	case old == nil:
+		// 迁移文件已存在但没有快照时，以当前的表结构建立快照
+		return []*output{snapshot}, nil
+	case old.Dialect != current.Dialect:
+		return nil, fmt.Errorf("table %s: dialect changed from %s to %s", current.Table, old.Dialect, current.Dialect)
+	}
+
+	changes := diffSchema(old, current)
+	if len(changes) == 0 {
+		return []*output{snapshot}, nil
+	}
+	if !generator.Destructive {
+		destructive := make([]string, 0)
+		for _, c := range changes {
+			if c.Destructive() {
+				destructive = append(destructive, c.String())
+			}
+		}
+		if len(destructive) > 0 {
+			return nil, fmt.Errorf("table %s: destructive changes (%s), run with -allow-destructive to generate the migration",
+				current.Table, strings.Join(destructive, ", "))
+		}
+	}
+
+	alter := *generator
+	alter.Changes = changes
+	if files, err = renderLayer(root, &alter, l); err != nil {
+		return nil, err
+	}
+	return append(files, snapshot), nil
+}
+
+// replaceWith 返回直接使用 src 替换已有内容的合并函数
+func replaceWith(src []byte) func(old []byte) ([]byte, error) {
+	return func([]byte) ([]byte, error) {
+		return src, nil
+	}
+}
+
+// Ident 转换为当前方言中带引号的标识符
+func (g *Generate) Ident(name string) string {
+	if g.IsMySQL() {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Quote 转换为 SQL 字符串字面量
+func (g *Generate) Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// SQLDefault 列的默认值，字符串类型自动加上引号
+func (f *Field) SQLDefault() string {
+	if f.Default == "" {
+		return ""
+	}
+	if (f.Type == "string" || f.Type == "text") && !strings.HasPrefix(f.Default, "'") {
+		return (&Generate{}).Quote(f.Default)
+	}
+	return f.Default
+}
+
+// IsIndex 是否需要创建普通索引
+func (f *Field) IsIndex() bool {
+	return f.Index == "true"
+}
+
+// IsUnique 是否需要创建唯一索引
+func (f *Field) IsUnique() bool {
+	return f.Unique == "true"
+}
+
+// migrationPath 返回迁移文件的路径，已存在同一张表的迁移文件时沿用其版本号，避免每次生成新的文件
+// 增量迁移使用新的版本号，名称为 <version>_alter_<table>
+func migrationPath(dir string, generator *Generate, suffix string) string {
+	if len(generator.Changes) > 0 {
+		return filepath.Join(dir, generator.Version+"_alter_"+generator.Table()+suffix)
+	}
+	var (
+		name    = "_create_" + generator.Table()
+		version = generator.Version
+		pattern = regexp.MustCompile(`^([0-9]+)` + regexp.QuoteMeta(name) + `\.`)
+	)
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+name+".*"))
+	for _, match := range matches {
+		if m := pattern.FindStringSubmatch(filepath.Base(match)); m != nil {
+			version = m[1]
+			break
+		}
+	}
+	return filepath.Join(dir, version+name+suffix)
+}
+
+// newVersion 生成迁移版本号，同一次生成的多个实体依次递增，保证版本号不重复
+func newVersion(now time.Time, i int) string {
+	return now.UTC().Add(time.Duration(i) * time.Second).Format("20060102150405")
+}
+
+// checkDialect 校验数据库方言
+func checkDialect(dialect string) error {
+	if !contains(dialects, dialect) {
+		return fmt.Errorf("unknown dialect %q, available: %s", dialect, strings.Join(dialects, ","))
+	}
+	return nil
+}
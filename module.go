@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// findModule 从目录开始逐级向上查找 go.mod，返回其 module 路径
+func findModule(dir string) (string, error) {
+	var (
+		err  error
+		abs  string
+		data []byte
+	)
+	if abs, err = filepath.Abs(dir); err != nil {
+		return "", err
+	}
+
+	for d := abs; ; d = filepath.Dir(d) {
+		filename := filepath.Join(d, "go.mod")
+		if data, err = os.ReadFile(filename); err == nil {
+			path := modulePath(data)
+			if path == "" {
+				return "", fmt.Errorf("%s: missing module directive", filename)
+			}
+			return path, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		if filepath.Dir(d) == d {
+			return "", fmt.Errorf("go.mod not found in %s or any parent directory", abs)
+		}
+	}
+}
+
+// modulePath 解析 go.mod 中的 module 指令
+func modulePath(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		path := fields[1]
+		if strings.HasPrefix(path, `"`) || strings.HasPrefix(path, "`") {
+			if v, err := strconv.Unquote(path); err == nil {
+				path = v
+			}
+		}
+		return path
+	}
+	return ""
+}
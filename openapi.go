@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPITypes 字段类型对应的 OpenAPI 类型与格式
+var openAPITypes = map[string][2]string{
+	"int":             {"integer", ""},
+	"int8":            {"integer", "int32"},
+	"int16":           {"integer", "int32"},
+	"int32":           {"integer", "int32"},
+	"int64":           {"integer", "int64"},
+	"uint":            {"integer", ""},
+	"uint8":           {"integer", "int32"},
+	"byte":            {"integer", "int32"},
+	"uint16":          {"integer", "int32"},
+	"uint32":          {"integer", "int32"},
+	"uint64":          {"integer", "int64"},
+	"float32":         {"number", "float"},
+	"float64":         {"number", "double"},
+	"decimal.Decimal": {"string", "decimal"},
+	"string":          {"string", ""},
+	"text":            {"string", ""},
+	"bool":            {"boolean", ""},
+	"uuid.UUID":       {"string", "uuid"},
+	"time.Time":       {"string", "date-time"},
+	"[]byte":          {"string", "byte"},
+}
+
+// openAPIItems 数组类型字段的元素类型
+var openAPIItems = map[string]string{
+	"pq.StringArray": "string",
+	"pq.Int64Array":  "int64",
+}
+
+// Schema 字段的 OpenAPI schema，使用 YAML 流式写法，写入文件前统一转换为块格式
+func (f *Field) Schema() string {
+	var (
+		kind   string
+		format string
+		parts  = make([]string, 0)
+		// 时间字段使用请求与回包中的类型
+		typeName = strings.TrimPrefix(f.GoType(), "*")
+	)
+	if item, ok := openAPIItems[f.Type]; ok {
+		kind = "array"
+		t := openAPITypes[item]
+		items := "type: " + t[0]
+		if t[1] != "" {
+			items += ", format: " + t[1]
+		}
+		parts = append(parts, "type: array", "items: {"+items+"}")
+	} else if t, ok := openAPITypes[typeName]; ok {
+		kind, format = t[0], t[1]
+		parts = append(parts, "type: "+kind)
+	} else {
+		kind = "object"
+		parts = append(parts, "type: object")
+	}
+
+	constraints, validFormat := f.constraints(kind)
+	if validFormat != "" {
+		format = validFormat
+	}
+	if format != "" {
+		parts = append(parts, "format: "+format)
+	}
+	parts = append(parts, constraints...)
+	if f.IsNullable() {
+		parts = append(parts, "nullable: true")
+	}
+	if f.Comment != "" {
+		parts = append(parts, "description: "+strconv.Quote(f.Comment))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// constraints 将 validate 规则转换为 OpenAPI 约束，同时返回规则中声明的格式
+func (f *Field) constraints(kind string) ([]string, string) {
+	var (
+		format string
+		out    = make([]string, 0)
+		// 最小值与最大值在不同类型中对应不同的关键字
+		min = map[string]string{"integer": "minimum", "number": "minimum", "string": "minLength", "array": "minItems"}[kind]
+		max = map[string]string{"integer": "maximum", "number": "maximum", "string": "maxLength", "array": "maxItems"}[kind]
+	)
+	for _, rule := range splitList(f.Validate) {
+		name, value, _ := strings.Cut(rule, "=")
+		switch name {
+		case "oneof":
+			values := strings.Fields(value)
+			if kind == "string" {
+				for i, v := range values {
+					values[i] = strconv.Quote(v)
+				}
+			}
+			out = append(out, "enum: ["+strings.Join(values, ", ")+"]")
+		case "min", "gte":
+			if min != "" {
+				out = append(out, min+": "+value)
+			}
+		case "max", "lte":
+			if max != "" {
+				out = append(out, max+": "+value)
+			}
+		case "gt":
+			if kind == "integer" || kind == "number" {
+				out = append(out, "minimum: "+value, "exclusiveMinimum: true")
+			}
+		case "lt":
+			if kind == "integer" || kind == "number" {
+				out = append(out, "maximum: "+value, "exclusiveMaximum: true")
+			}
+		case "len":
+			if kind == "string" || kind == "array" {
+				out = append(out, min+": "+value, max+": "+value)
+			}
+		case "email", "uuid":
+			format = name
+		case "url", "uri":
+			format = "uri"
+		}
+	}
+	return out, format
+}
+
+// Schema 关联字段在回包中的 OpenAPI schema，引用关联实体的 Info
+func (r *Relation) Schema() string {
+	ref := `{$ref: "#/components/schemas/` + r.Target + `Info"}`
+	if r.IsMany() {
+		return "{type: array, items: " + ref + "}"
+	}
+	return ref
+}
+
+// WithSchema 请求中 with 参数的 OpenAPI schema
+func (g *Generate) WithSchema() string {
+	return "{type: array, items: {type: string, enum: [" + strings.ReplaceAll(g.With(), " ", ", ") + "]}}"
+}
+
+// HasRequired 创建请求中是否包含必须的参数
+func (g *Generate) HasRequired() bool {
+	for _, f := range g.Fields {
+		if !f.IsID() && f.IsParameter() && f.IsRequired() {
+			return true
+		}
+	}
+	return false
+}
+
+// formatYAML 格式化 YAML 文档，流式写法统一转换为块格式
+func formatYAML(src []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, err
+	}
+	return encodeYAML(&doc)
+}
+
+// encodeYAML 以两个空格缩进输出 YAML 文档
+func encodeYAML(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	blockStyle(doc)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle 去掉节点的流式写法，保留字符串的引号
+func blockStyle(n *yaml.Node) {
+	n.Style &^= yaml.FlowStyle
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// mergeOpenAPI 将生成的文档合并到已有的 openapi.yaml
+//   - paths 中的路径与 components 中的组件按名称整体替换，其余手写的路径与组件保持不变
+//   - openapi、info 等其余顶层字段只在不存在时写入
+func mergeOpenAPI(old, src []byte) ([]byte, error) {
+	var (
+		err error
+		dst *yaml.Node
+		doc *yaml.Node
+	)
+	if dst, err = openAPIRoot(old); err != nil {
+		return nil, fmt.Errorf("existing document: %w", err)
+	}
+	if doc, err = openAPIRoot(src); err != nil {
+		return nil, fmt.Errorf("generated document: %w", err)
+	}
+
+	root := dst.Content[0]
+	for i := 0; i+1 < len(doc.Content[0].Content); i += 2 {
+		key, value := doc.Content[0].Content[i], doc.Content[0].Content[i+1]
+		switch j := mappingIndex(root, key.Value); {
+		case j < 0:
+			root.Content = append(root.Content, key, value)
+		case key.Value == "paths":
+			mergeMapping(root.Content[j+1], value, 1)
+		case key.Value == "components":
+			mergeMapping(root.Content[j+1], value, 2)
+		}
+	}
+	return encodeYAML(dst)
+}
+
+// sharedSchemas 所有实体的文档中都会生成的组件
+var sharedSchemas = []string{"Response"}
+
+// removeOpenAPI 从已有的 openapi.yaml 中删除生成文档中的路径与组件
+// 只删除名称完全一致的条目，UserRole 等以实体名称开头的其他实体的组件以及共用的统一回包不会被删除
+func removeOpenAPI(old, src []byte) ([]byte, error) {
+	var (
+		err error
+		dst *yaml.Node
+		doc *yaml.Node
+	)
+	if dst, err = openAPIRoot(old); err != nil {
+		return nil, fmt.Errorf("existing document: %w", err)
+	}
+	if doc, err = openAPIRoot(src); err != nil {
+		return nil, fmt.Errorf("generated document: %w", err)
+	}
+
+	root, gen := dst.Content[0], doc.Content[0]
+	if paths := mappingValue(gen, "paths"); paths != nil {
+		for i := 0; i < len(paths.Content); i += 2 {
+			removeKey(mappingValue(root, "paths"), paths.Content[i].Value)
+		}
+	}
+	if components := mappingValue(gen, "components"); components != nil {
+		for i := 0; i+1 < len(components.Content); i += 2 {
+			var (
+				kind  = components.Content[i].Value
+				items = components.Content[i+1]
+			)
+			for j := 0; j < len(items.Content); j += 2 {
+				if name := items.Content[j].Value; !contains(sharedSchemas, name) {
+					removeKey(mappingValue(mappingValue(root, "components"), kind), name)
+				}
+			}
+		}
+	}
+	return encodeYAML(dst)
+}
+
+// openAPIRoot 解析 YAML 文档，要求顶层为 mapping，空文档返回空的 mapping
+func openAPIRoot(src []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("top level of document is not a mapping")
+	}
+	return &doc, nil
+}
+
+// mergeMapping 将 src 中的条目写入 dst，depth 为按名称整体替换的层级
+func mergeMapping(dst, src *yaml.Node, depth int) {
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		*dst = *src
+		return
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		switch j := mappingIndex(dst, key.Value); {
+		case j < 0:
+			dst.Content = append(dst.Content, key, value)
+		case depth > 1:
+			mergeMapping(dst.Content[j+1], value, depth-1)
+		default:
+			dst.Content[j+1] = value
+		}
+	}
+}
+
+// mappingIndex 返回 mapping 中键所在的下标，不存在时返回 -1
+func mappingIndex(n *yaml.Node, key string) int {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// mappingValue 返回 mapping 中键对应的值
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if i := mappingIndex(n, key); i >= 0 {
+		return n.Content[i+1]
+	}
+	return nil
+}
+
+// removeKey 删除 mapping 中的键
+func removeKey(n *yaml.Node, key string) {
+	if i := mappingIndex(n, key); i >= 0 {
+		n.Content = append(n.Content[:i], n.Content[i+2:]...)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// 受保护区域标记，区域内的内容在重新生成时会原样保留
+//
+//	// generator:begin custom
+//	...手写代码...
+//	// generator:end custom
+const (
+	regionBegin = "// generator:begin "
+	regionEnd   = "// generator:end "
+)
+
+// region 受保护区域
+type region struct {
+	Name  string
+	Begin int // 开始标记所在行
+	End   int // 结束标记所在行
+}
+
+// splitLines 按行拆分，保留每行的换行符
+func splitLines(src []byte) []string {
+	lines := make([]string, 0, bytes.Count(src, []byte{'\n'})+1)
+	reader := bufio.NewReader(bytes.NewReader(src))
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			lines = append(lines, line)
+		}
+		if err != nil {
+			return lines
+		}
+	}
+}
+
+// findRegions 查找所有受保护区域，标记不成对或重名时返回错误
+func findRegions(lines []string) ([]*region, error) {
+	var (
+		list    = make([]*region, 0)
+		names   = make(map[string]struct{})
+		current *region
+	)
+	for i, line := range lines {
+		text := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(text, regionBegin):
+			name := strings.TrimSpace(strings.TrimPrefix(text, regionBegin))
+			if current != nil {
+				return nil, fmt.Errorf("line %d: region %s begins inside region %s", i+1, name, current.Name)
+			}
+			if _, ok := names[name]; ok {
+				return nil, fmt.Errorf("line %d: duplicate region %s", i+1, name)
+			}
+			names[name] = struct{}{}
+			current = &region{Name: name, Begin: i}
+		case strings.HasPrefix(text, regionEnd):
+			name := strings.TrimSpace(strings.TrimPrefix(text, regionEnd))
+			if current == nil || current.Name != name {
+				return nil, fmt.Errorf("line %d: unexpected end of region %s", i+1, name)
+			}
+			current.End = i
+			list = append(list, current)
+			current = nil
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("line %d: region %s is not closed", current.Begin+1, current.Name)
+	}
+	return list, nil
+}
+
+// hasRegions 文件中是否包含受保护区域
+func hasRegions(src []byte) bool {
+	return bytes.Contains(src, []byte(regionBegin))
+}
+
+// keepRegions 将旧文件中受保护区域的内容填充到新生成的内容中
+// 旧文件中存在而新内容中已不存在的区域会返回错误，避免手写代码丢失
+func keepRegions(src, old []byte) ([]byte, error) {
+	var (
+		err      error
+		oldList  []*region
+		newList  []*region
+		oldLines = splitLines(old)
+		newLines = splitLines(src)
+		content  = make(map[string][]string)
+	)
+	if oldList, err = findRegions(oldLines); err != nil {
+		return nil, fmt.Errorf("existing file: %w", err)
+	}
+	if newList, err = findRegions(newLines); err != nil {
+		return nil, fmt.Errorf("generated file: %w", err)
+	}
+
+	for _, r := range oldList {
+		content[r.Name] = oldLines[r.Begin+1 : r.End]
+	}
+
+	var (
+		buf  bytes.Buffer
+		last = 0
+	)
+	for _, r := range newList {
+		lines, ok := content[r.Name]
+		if !ok {
+			continue
+		}
+		delete(content, r.Name)
+		buf.WriteString(strings.Join(newLines[last:r.Begin+1], ""))
+		buf.WriteString(strings.Join(lines, ""))
+		last = r.End
+	}
+	buf.WriteString(strings.Join(newLines[last:], ""))
+
+	for _, r := range oldList {
+		if _, ok := content[r.Name]; ok && len(content[r.Name]) > 0 {
+			return nil, fmt.Errorf("region %s no longer exists in generated code, move its content first", r.Name)
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"strings"
+)
+
+// relationKinds 可用的关联类型
+var relationKinds = []string{"belongs_to", "has_many", "many_to_many"}
+
+// Relation 实体之间的关联，通过字段上的 rel tag 声明
+//   - belongs_to 声明在外键字段上，如 UserId int64 `rel:"belongs_to:User"`，关联字段为去掉 Id 后缀的 User
+//   - has_many 与 many_to_many 声明在关联实体的切片上，如 Devices []Device `rel:"has_many:Device"`，该字段不对应列
+//     has_many 的外键为关联实体中的 <实体名>Id 字段，many_to_many 使用中间表 <表名单数>_<关联实体的表名>
+//     many_to_many 可以指定中间表，如 rel:"many_to_many:User:user_roles"，两端声明同一张中间表时只生成一次
+type Relation struct {
+	Kind       string    // belongs_to、has_many、many_to_many
+	Name       string    // entity 与回包中的关联字段名，如 User、Devices
+	Json       string    // 回包中的 json 名称，同时做为请求中 with 的取值
+	Target     string    // 关联的实体名称
+	ForeignKey string    // 外键字段名，belongs_to 位于本实体，has_many 位于关联实体
+	JoinTable  string    // many_to_many 的中间表
+	Owner      *Generate // 声明关联的实体
+	Entity     *Generate // 关联的实体，不存在时由 validate 报错
+	Join       *Generate // many_to_many 中间表的生成模型
+	Inverse    bool      // 中间表已由另一端声明，本端不生成中间表的 entity 与迁移文件
+	Field      *Field    // 声明关联的字段，用于报告问题的位置
+	Char       string
+}
+
+// associationActions 维护 many_to_many 关联的操作
+var associationActions = []string{"add", "remove", "replace"}
+
+// Association 维护 many_to_many 关联的接口，如 AddRoles 添加关联的 Role
+type Association struct {
+	*Relation
+	Action string // add、remove、replace
+}
+
+// relate 解析所有实体字段上的关联，需要在筛选实体之前调用，未生成的实体同样可以被关联
+// has_many 与 many_to_many 的字段从字段列表中移除，只保留在关联中
+func relate(list []*Generate) {
+	var (
+		entities = make(map[string]*Generate, len(list))
+		joins    = make(map[string]*Generate)
+	)
+	for _, g := range list {
+		entities[g.TitleName] = g
+	}
+	for _, g := range list {
+		fields := make([]*Field, 0, len(g.Fields))
+		for _, f := range g.Fields {
+			if f.Rel == "" {
+				fields = append(fields, f)
+				continue
+			}
+			kind, target, _ := strings.Cut(f.Rel, ":")
+			target, table, _ := strings.Cut(target, ":")
+			r := &Relation{Kind: kind, Target: target, Owner: g, Entity: entities[target], Field: f, Char: "`"}
+			if kind == "belongs_to" {
+				r.Name, r.Json, r.ForeignKey = strings.TrimSuffix(f.Name, "Id"), strings.TrimSuffix(f.JsonName(), "_id"), f.Name
+				fields = append(fields, f)
+			} else {
+				r.Name, r.Json, r.ForeignKey = f.Name, f.JsonName(), g.TitleName+"Id"
+			}
+			if kind == "many_to_many" {
+				r.JoinTable = table
+				if table == "" {
+					table = Camel2Case(target) + "s"
+					if r.Entity != nil {
+						table = r.Entity.Table()
+					}
+					r.JoinTable = g.FileName + "_" + table
+				}
+				if r.Join, r.Inverse = joins[r.JoinTable]; !r.Inverse {
+					r.Join = join(g, r)
+					joins[r.JoinTable] = r.Join
+				}
+			}
+			g.Relations = append(g.Relations, r)
+		}
+		g.Fields = fields
+	}
+}
+
+// join 构建 many_to_many 中间表的生成模型，两个外键组成联合主键，关联实体的外键创建索引
+func join(g *Generate, r *Relation) *Generate {
+	out := newGenerator(g.ProjectName, g.TitleName+r.Target)
+	out.TableName, out.Char = r.JoinTable, g.Char
+	out.Comment = g.TitleName + " 与 " + r.Target + " 的关联"
+	out.Fields = []*Field{
+		{Name: r.OwnerKey(), Type: "int64", Json: r.OwnerColumn(), JsonTag: r.OwnerColumn(), Required: "true", Primary: true, Char: "`"},
+		{Name: r.TargetKey(), Type: "int64", Json: r.TargetColumn(), JsonTag: r.TargetColumn(), Required: "true", Primary: true, Index: "true", Char: "`"},
+	}
+	return out
+}
+
+// OwnerKey 中间表中本实体的外键字段名，如 UserId
+func (r *Relation) OwnerKey() string {
+	return r.Owner.TitleName + "Id"
+}
+
+// OwnerColumn 中间表中本实体的外键列名，如 user_id
+func (r *Relation) OwnerColumn() string {
+	return Camel2Case(r.OwnerKey())
+}
+
+// TargetKey 中间表中关联实体的外键字段名，如 RoleId
+func (r *Relation) TargetKey() string {
+	return r.Target + "Id"
+}
+
+// TargetColumn 中间表中关联实体的外键列名，如 role_id
+func (r *Relation) TargetColumn() string {
+	return Camel2Case(r.TargetKey())
+}
+
+// Ids 关联接口中关联实体 id 列表的参数名，如 roleIds
+func (r *Relation) Ids() string {
+	return LeftToLower(r.Target) + "Ids"
+}
+
+// Request 关联接口的请求名称，如 UserRolesRequest
+func (r *Relation) Request() string {
+	return r.Owner.TitleName + r.Name + "Request"
+}
+
+// Path 关联接口路径中的关联名称，如 roles、device-groups
+func (r *Relation) Path() string {
+	return strings.ReplaceAll(r.Json, "_", "-")
+}
+
+// Method 关联接口在 store 与 bll 中的方法名，如 AddRoles
+func (a *Association) Method() string {
+	return Ucfirst(a.Action) + a.Name
+}
+
+// Handler 关联接口在 api 中的处理函数名，如 addRoles
+func (a *Association) Handler() string {
+	return a.Action + a.Name
+}
+
+// Verb RESTful 路由中关联接口的请求方法，添加为 POST，移除为 DELETE，替换为 PUT
+func (a *Association) Verb() string {
+	switch a.Action {
+	case "add":
+		return "POST"
+	case "remove":
+		return "DELETE"
+	}
+	return "PUT"
+}
+
+// Operation OpenAPI 中 RESTful 关联接口的请求方法，如 post
+func (a *Association) Operation() string {
+	return strings.ToLower(a.Verb())
+}
+
+// Summary 关联接口的说明
+func (a *Association) Summary() string {
+	switch a.Action {
+	case "add":
+		return "添加关联的 " + a.Target
+	case "remove":
+		return "移除关联的 " + a.Target
+	}
+	return "替换关联的 " + a.Target
+}
+
+// IsMany 关联的是否为多个实体
+func (r *Relation) IsMany() bool {
+	return r.Kind != "belongs_to"
+}
+
+// EntityType 关联字段在 entity 中的类型
+func (r *Relation) EntityType() string {
+	if r.IsMany() {
+		return "[]*" + r.Target
+	}
+	return "*" + r.Target
+}
+
+// InfoType 关联字段在回包中的类型
+func (r *Relation) InfoType() string {
+	if r.IsMany() {
+		return "[]*" + r.Target + "Info"
+	}
+	return "*" + r.Target + "Info"
+}
+
+// GormTag 关联字段在 entity 中的 gorm tag
+func (r *Relation) GormTag() string {
+	if r.Kind == "many_to_many" {
+		return "many2many:" + r.JoinTable
+	}
+	return "foreignKey:" + r.ForeignKey
+}
+
+// Joins 需要由本实体生成的中间表
+func (g *Generate) Joins() []*Generate {
+	list := make([]*Generate, 0)
+	for _, r := range g.Relations {
+		if r.Join != nil && !r.Inverse {
+			list = append(list, r.Join)
+		}
+	}
+	return list
+}
+
+// Associations 维护 many_to_many 关联的接口，每个关联分别有添加、移除、替换三个接口
+func (g *Generate) Associations() []*Association {
+	list := make([]*Association, 0)
+	for _, r := range g.Relations {
+		list = append(list, r.Associations()...)
+	}
+	return list
+}
+
+// Associations 单个 many_to_many 关联的添加、移除、替换接口，其他关联为空
+func (r *Relation) Associations() []*Association {
+	if r.Kind != "many_to_many" {
+		return nil
+	}
+	list := make([]*Association, 0, len(associationActions))
+	for _, action := range associationActions {
+		list = append(list, &Association{Relation: r, Action: action})
+	}
+	return list
+}
+
+// IsForeignKey 是否为 belongs_to 关联的外键字段，外键列自动创建索引，并做为列表的查询条件
+func (f *Field) IsForeignKey() bool {
+	return strings.HasPrefix(f.Rel, "belongs_to:")
+}
+
+// With 请求中 with 可选的取值，即所有关联的 json 名称，以空格分隔
+func (g *Generate) With() string {
+	names := make([]string, 0, len(g.Relations))
+	for _, r := range g.Relations {
+		names = append(names, r.Json)
+	}
+	return strings.Join(names, " ")
+}
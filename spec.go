@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// specExts 实体描述文件的扩展名，JSON 文档同样使用 YAML 解析
+var specExts = []string{".yaml", ".yml", ".json"}
+
+// fieldTypes 内置类型映射中可用的字段类型，与 entity.schema.json 中的 type 保持一致
+// 此外还可以使用 map 类型以及配置文件 types 中声明的自定义类型
+var fieldTypes = []string{
+	"int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64",
+	"decimal.Decimal", "string", "text", "bool", "uuid.UUID", "time.Time", "*time.Time", "[]byte", "json.RawMessage",
+	"Point", "pq.StringArray", "pq.Int64Array",
+}
+
+// EntitySpec 实体描述文件，代替 dto 结构体与 tag 声明实体
+type EntitySpec struct {
+	Schema  string       `yaml:"$schema"` // JSON Schema 的路径，仅用于编辑器补全
+	Name    string       `yaml:"name"`    // 实体名称，如 User
+	Table   string       `yaml:"table"`   // 表名，为空时为实体名称转换为下划线形式后加上 s
+	Comment string       `yaml:"comment"` // 实体注释
+	Fields  []*FieldSpec `yaml:"fields"`
+}
+
+// FieldSpec 字段描述
+type FieldSpec struct {
+	Name       string `yaml:"name"`        // 字段名称，如 ChargeMonitor
+	Type       string `yaml:"type"`        // 字段类型
+	Json       string `yaml:"json"`        // json 名称与列名，为空时为字段名称转换为下划线形式
+	Parameter  bool   `yaml:"parameter"`   // 是否做为参数
+	Required   bool   `yaml:"required"`    // 是否为必须的参数
+	Time       bool   `yaml:"time"`        // 是否为时间字段
+	TimeFormat string `yaml:"time_format"` // 时间字段在请求与回包中的格式，为空时使用配置中的格式
+	Validate   string `yaml:"validate"`    // validate 规则，如 oneof=1 2
+	Default    string `yaml:"default"`     // 列的默认值
+	DBType     string `yaml:"db_type"`     // 列类型，覆盖类型映射中的列类型
+	Index      bool   `yaml:"index"`       // 是否创建索引
+	Unique     bool   `yaml:"unique"`      // 是否创建唯一索引
+	Rel        string `yaml:"rel"`         // 与其他实体的关联，如 belongs_to:User
+	Proto      string `yaml:"proto"`       // protobuf 字段编号，为空时按字段的位置生成
+	Comment    string `yaml:"comment"`     // 字段注释
+}
+
+// isSpec 是否为实体描述文件
+func isSpec(path string) bool {
+	return contains(specExts, strings.ToLower(filepath.Ext(path)))
+}
+
+// specFiles 目录中的实体描述文件，只读取 *.entity.yaml 等文件，避免误读目录中的配置文件
+func specFiles(dir string) ([]string, error) {
+	out := make([]string, 0)
+	for _, ext := range specExts {
+		files, err := filepath.Glob(filepath.Join(dir, "*.entity"+ext))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, files...)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// loadSpecs 解析实体描述文件，一个文件中可以包含多个以 --- 分隔的实体
+func loadSpecs(projectName string, files []string) ([]*Generate, error) {
+	list := make([]*Generate, 0)
+	for _, filename := range files {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var (
+			dec = yaml.NewDecoder(bytes.NewReader(data))
+			// 同时解析为节点，用于记录实体与字段所在的行
+			nodes = yaml.NewDecoder(bytes.NewReader(data))
+		)
+		// 未知的键（如拼写错误的 requried）直接报错，避免被静默忽略
+		dec.KnownFields(true)
+		for {
+			var (
+				doc  yaml.Node
+				spec = &EntitySpec{}
+			)
+			if err = dec.Decode(spec); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("%s: %w", filename, err)
+			}
+			if err = nodes.Decode(&doc); err != nil {
+				return nil, fmt.Errorf("%s: %w", filename, err)
+			}
+			generator, err := spec.generate(projectName)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", filename, doc.Line, err)
+			}
+			specPositions(filename, &doc, generator)
+			list = append(list, generator)
+		}
+	}
+	return list, nil
+}
+
+// generate 将实体描述转换为生成模型
+func (s *EntitySpec) generate(projectName string) (*Generate, error) {
+	if s.Name == "" {
+		return nil, errors.New("entity name is required")
+	}
+	generator := newGenerator(projectName, s.Name)
+	generator.TableName, generator.Comment = s.Table, s.Comment
+	for i, f := range s.Fields {
+		if f.Name == "" {
+			return nil, fmt.Errorf("entity %s: field #%d: name is required", s.Name, i+1)
+		}
+		if f.Json == "" {
+			f.Json = Camel2Case(f.Name)
+		}
+		generator.Fields = append(generator.Fields, &Field{
+			Name:       f.Name,
+			Type:       f.Type,
+			Json:       f.Json,
+			JsonTag:    f.Json,
+			Parameter:  boolTag(f.Parameter),
+			Required:   boolTag(f.Required),
+			Time:       boolTag(f.Time),
+			TimeFormat: f.TimeFormat,
+			Validate:   f.Validate,
+			Default:    f.Default,
+			DBType:     f.DBType,
+			Index:      boolTag(f.Index),
+			Unique:     boolTag(f.Unique),
+			Rel:        f.Rel,
+			Proto:      f.Proto,
+			Comment:    f.Comment,
+			Char:       "`",
+		})
+	}
+	return generator, nil
+}
+
+// specPositions 记录实体与字段在描述文件中的位置
+func specPositions(filename string, doc *yaml.Node, generator *Generate) {
+	if len(doc.Content) == 0 {
+		return
+	}
+	root := doc.Content[0]
+	generator.Pos = fmt.Sprintf("%s:%d", filename, root.Line)
+	if fields := mappingValue(root, "fields"); fields != nil {
+		for i, item := range fields.Content {
+			if i < len(generator.Fields) {
+				generator.Fields[i].Pos = fmt.Sprintf("%s:%d", filename, item.Line)
+			}
+		}
+	}
+}
+
+// boolTag 将布尔值转换为 tag 中的取值
+func boolTag(v bool) string {
+	if v {
+		return "true"
+	}
+	return ""
+}
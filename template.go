@@ -0,0 +1,79 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// templateFS 内置模板
+//
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// includes 内置模板依赖的其他内置模板，依赖的模板先于自身解析，自身的主体覆盖依赖模板的主体
+var includes = map[string][]string{
+	"migration_goose.tmpl": {"migration.tmpl"},
+}
+
+// builtinTemplate 根据名称查找内置模板文件，支持层名称（如 api）与文件名称（如 api.tmpl）
+func builtinTemplate(name string) (string, bool) {
+	if file, ok := m[name]; ok {
+		return file, true
+	}
+	if !strings.HasSuffix(name, ".tmpl") {
+		name += ".tmpl"
+	}
+	if _, err := fs.Stat(templateFS, "templates/"+name); err == nil {
+		return name, true
+	}
+	return "", false
+}
+
+// newTemplate 加载模板
+// 内置模板会依次解析内置内容与 dir 中的同名文件，同名文件可以整体替换模板，
+// 也可以只包含 {{define}} 块，只覆盖模板中对应的部分，依赖的内置模板同样可以覆盖；
+// 非内置模板直接读取模板文件
+func newTemplate(name, dir string) (*template.Template, error) {
+	var (
+		err  error
+		data []byte
+		t    *template.Template
+	)
+
+	file, ok := builtinTemplate(name)
+	if !ok {
+		if data, err = os.ReadFile(name); err != nil {
+			return nil, err
+		}
+		return template.New(filepath.Base(name)).Parse(string(data))
+	}
+
+	t = template.New(file)
+	for _, name := range append(append([]string{}, includes[file]...), file) {
+		if data, err = templateFS.ReadFile("templates/" + name); err != nil {
+			return nil, err
+		}
+		if t, err = t.Parse(string(data)); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if dir == "" {
+			continue
+		}
+		override := filepath.Join(dir, name)
+		if data, err = os.ReadFile(override); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if t, err = t.Parse(string(data)); err != nil {
+			return nil, fmt.Errorf("%s: %w", override, err)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// columnTypes 各方言中字段类型对应的列类型，map 类型使用 map 对应的列类型，未列出的类型使用 JSON
+// 项目中的自定义类型通过配置文件中的 types 声明，单个字段通过 db_type 指定
+var columnTypes = map[string]map[string]string{
+	"postgres": {
+		"int8":            "SMALLINT",
+		"int16":           "SMALLINT",
+		"int32":           "INTEGER",
+		"int":             "BIGINT",
+		"int64":           "BIGINT",
+		"uint8":           "SMALLINT",
+		"byte":            "SMALLINT",
+		"uint16":          "INTEGER",
+		"uint32":          "BIGINT",
+		"uint":            "NUMERIC(20)",
+		"uint64":          "NUMERIC(20)",
+		"float32":         "REAL",
+		"float64":         "DOUBLE PRECISION",
+		"decimal.Decimal": "NUMERIC",
+		"string":          "VARCHAR(255)",
+		"text":            "TEXT",
+		"bool":            "BOOLEAN",
+		"uuid.UUID":       "UUID",
+		"time.Time":       "TIMESTAMP",
+		"[]byte":          "BYTEA",
+		"json.RawMessage": "JSONB",
+		"Point":           "POINT",
+		"pq.StringArray":  "VARCHAR[]",
+		"pq.Int64Array":   "BIGINT[]",
+		"time":            "TIMESTAMP",
+		"map":             "JSONB",
+		"":                "JSON",
+	},
+	"mysql": {
+		"int8":            "TINYINT",
+		"int16":           "SMALLINT",
+		"int32":           "INT",
+		"int":             "BIGINT",
+		"int64":           "BIGINT",
+		"uint8":           "TINYINT UNSIGNED",
+		"byte":            "TINYINT UNSIGNED",
+		"uint16":          "SMALLINT UNSIGNED",
+		"uint32":          "INT UNSIGNED",
+		"uint":            "BIGINT UNSIGNED",
+		"uint64":          "BIGINT UNSIGNED",
+		"float32":         "FLOAT",
+		"float64":         "DOUBLE",
+		"decimal.Decimal": "DECIMAL(20,6)",
+		"string":          "VARCHAR(255)",
+		"text":            "TEXT",
+		"bool":            "BOOLEAN",
+		"uuid.UUID":       "CHAR(36)",
+		"time.Time":       "TIMESTAMP",
+		"[]byte":          "BLOB",
+		"json.RawMessage": "JSON",
+		"Point":           "POINT",
+		"pq.StringArray":  "JSON",
+		"pq.Int64Array":   "JSON",
+		"time":            "TIMESTAMP",
+		"map":             "JSON",
+		"":                "JSON",
+	},
+}
+
+// typePackages 字段类型中的包名对应的 import 路径，项目中的其他包通过配置文件中的 imports 声明
+var typePackages = map[string]string{
+	"decimal": "github.com/shopspring/decimal",
+	"json":    "encoding/json",
+	"pq":      "github.com/lib/pq",
+	"time":    "time",
+	"uuid":    "github.com/google/uuid",
+}
+
+// qualifier 字段类型中引用的包名，如 map[string]decimal.Decimal 中的 decimal
+var qualifier = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\.[A-Za-z_]`)
+
+// ColumnType 字段在当前方言中的列类型，优先使用 db_type，主键使用自增类型
+func (g *Generate) ColumnType(f *Field) string {
+	types, ok := columnTypes[g.Dialect]
+	if !ok {
+		types = columnTypes["postgres"]
+	}
+	switch {
+	case f.DBType != "":
+		return f.DBType
+	case f.IsID() && g.IsMySQL():
+		return "BIGINT AUTO_INCREMENT"
+	case f.IsID():
+		return "BIGSERIAL"
+	}
+	// 指针类型与其指向的类型使用相同的列类型，列可以为空，配置文件中的映射优先于内置的时间类型
+	typeName := strings.TrimPrefix(f.Type, "*")
+	if t, ok := g.Types[typeName]; ok {
+		return t
+	}
+	if f.IsTime() {
+		return types["time"]
+	}
+	if t, ok := types[typeName]; ok {
+		return t
+	}
+	if strings.HasPrefix(typeName, "map[") {
+		return types["map"]
+	}
+	return types[""]
+}
+
+// bind 根据生成选项设置字段的列类型与时间格式，供 entity 等模板中的字段使用
+func (g *Generate) bind() {
+	for _, f := range g.Fields {
+		f.Column = g.ColumnType(f)
+		if f.IsTime() && f.TimeFormat == "" {
+			f.TimeFormat = g.TimeFormat
+		}
+	}
+}
+
+// Imports 请求与回包中的字段类型引用的包
+func (g *Generate) Imports() []string {
+	return g.imports((*Field).GoType)
+}
+
+// EntityImports entity 中的字段类型引用的包
+func (g *Generate) EntityImports() []string {
+	return g.imports((*Field).EntityType)
+}
+
+// TypeImports dto 中的字段类型引用的包
+func (g *Generate) TypeImports() []string {
+	return g.imports(func(f *Field) string { return f.Type })
+}
+
+// imports 字段类型引用的包的 import 路径，未声明的包忽略，由 validate 报错
+func (g *Generate) imports(typeOf func(f *Field) string) []string {
+	set := make(map[string]bool)
+	for _, f := range g.Fields {
+		for _, pkg := range packages(typeOf(f)) {
+			if path, ok := g.importPath(pkg); ok {
+				set[path] = true
+			}
+		}
+	}
+	out := make([]string, 0, len(set))
+	for path := range set {
+		out = append(out, path)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// importPath 包名对应的 import 路径，配置文件中的声明优先
+func (g *Generate) importPath(pkg string) (string, bool) {
+	if path, ok := g.Packages[pkg]; ok {
+		return path, true
+	}
+	path, ok := typePackages[pkg]
+	return path, ok
+}
+
+// knownType 字段类型是否有对应的列类型，map 类型、值对象与指定了 db_type 的字段均可使用，指针类型按其指向的类型判断
+func (g *Generate) knownType(f *Field) bool {
+	typeName := strings.TrimPrefix(f.Type, "*")
+	if f.DBType != "" || f.Object || contains(fieldTypes, typeName) || strings.HasPrefix(typeName, "map[") {
+		return true
+	}
+	_, ok := g.Types[typeName]
+	return ok
+}
+
+// ConvertsTime 是否有参数在请求与 entity 之间转换时需要 time 包
+func (g *Generate) ConvertsTime() bool {
+	for _, f := range g.Fields {
+		if f.IsParameter() && f.ConvertsTime() {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdatesObject 更新的参数中是否有以 JSON 存储的值对象
+func (g *Generate) UpdatesObject() bool {
+	for _, f := range g.Fields {
+		if f.IsParameter() && !f.IsRequired() && f.Object {
+			return true
+		}
+	}
+	return false
+}
+
+// FiltersTime 查询条件中是否有需要转换的时间字段
+func (g *Generate) FiltersTime() bool {
+	for _, f := range g.Fields {
+		if f.IsFilter() && f.ConvertsTime() {
+			return true
+		}
+	}
+	return false
+}
+
+// packages 类型中引用的包名
+func packages(typeName string) []string {
+	out := make([]string, 0)
+	for _, m := range qualifier.FindAllStringSubmatch(typeName, -1) {
+		if !contains(out, m[1]) {
+			out = append(out, m[1])
+		}
+	}
+	return out
+}
+
+// typeAliases 列类型的别名，比较列类型时统一为同一名称，较长的别名在前
+var typeAliases = [][2]string{
+	{"TIMESTAMP WITHOUT TIME ZONE", "TIMESTAMP"},
+	{"TIMESTAMP WITH TIME ZONE", "TIMESTAMPTZ"},
+	{"CHARACTER VARYING", "VARCHAR"},
+	{"CHARACTER", "CHAR"},
+	{"DECIMAL", "NUMERIC"},
+	{"FLOAT8", "DOUBLE PRECISION"},
+	{"FLOAT4", "REAL"},
+	{"INT8", "BIGINT"},
+	{"INT4", "INTEGER"},
+	{"INT2", "SMALLINT"},
+	{"INT", "INTEGER"},
+	{"BOOL", "BOOLEAN"},
+}
+
+// integerTypes 整数列类型，MySQL 中的显示宽度不影响取值范围，比较时忽略
+var integerTypes = []string{"TINYINT", "SMALLINT", "MEDIUMINT", "INTEGER", "BIGINT"}
+
+// canonicalType 统一列类型的写法，用于判断两个列类型是否相同
+func canonicalType(t string) string {
+	t = strings.Join(strings.Fields(strings.ToUpper(t)), " ")
+	t = strings.ReplaceAll(t, " (", "(")
+	// MySQL 中的 BOOLEAN 为 TINYINT(1) 的别名
+	if t == "TINYINT(1)" {
+		return "BOOLEAN"
+	}
+	for _, alias := range typeAliases {
+		if rest := strings.TrimPrefix(t, alias[0]); rest != t && (rest == "" || !isWordRune(rune(rest[0]))) {
+			t = alias[1] + rest
+			break
+		}
+	}
+	if i := strings.Index(t, "("); i > 0 && contains(integerTypes, t[:i]) {
+		if j := strings.Index(t, ")"); j > i {
+			t = t[:i] + t[j+1:]
+		}
+	}
+	return t
+}
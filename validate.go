@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errInvalid lint 发现 dto 中存在问题
+var errInvalid = errors.New("invalid entities")
+
+// maxProtoNumber protobuf 字段编号的最大值，19000 到 19999 为保留编号
+const maxProtoNumber = 1<<29 - 1
+
+// flagTags 取值只能为 true 或 false 的 tag
+var flagTags = []string{"parameter", "required", "time", "index", "unique"}
+
+// problem 生成前检查发现的问题
+type problem struct {
+	Pos     string // 问题所在的位置 file:line，通过反射构建时为空
+	Entity  string
+	Field   string
+	Message string
+}
+
+// String 问题描述，如 dto/dto.go:20: User.Fingerprint: malformed tag
+func (p *problem) String() string {
+	name := p.Entity
+	if p.Field != "" {
+		name += "." + p.Field
+	}
+	if p.Pos != "" {
+		return p.Pos + ": " + name + ": " + p.Message
+	}
+	return name + ": " + p.Message
+}
+
+// problems 多个问题组成的错误
+type problems []*problem
+
+func (list problems) Error() string {
+	lines := make([]string, 0, len(list)+1)
+	lines = append(lines, fmt.Sprintf("%d problem(s) found:", len(list)))
+	for _, p := range list {
+		lines = append(lines, "  "+p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validate 检查生成模型，返回所有发现的问题
+//   - 必须包含 int64 类型的 Id 字段
+//   - tag 必须是以空格分隔的 key:"value"，parameter 等标记只能为 true 或 false
+//   - 字段必须有 json 名称且不能重复，类型必须有对应的列类型，引用的包必须有 import 路径
+//   - required 只能用于参数，time 只能用于 int64 字段
+//   - protobuf 字段编号必须有效且不能重复
+func validate(list []*Generate) problems {
+	out := make(problems, 0)
+	for _, g := range list {
+		report := func(f *Field, format string, args ...interface{}) {
+			p := &problem{Pos: g.Pos, Entity: g.TitleName, Message: fmt.Sprintf(format, args...)}
+			if f != nil {
+				p.Pos, p.Field = f.Pos, f.Name
+			}
+			out = append(out, p)
+		}
+
+		if !g.HasID() {
+			report(nil, "missing Id field")
+		}
+		names := make(map[string]string)
+		numbers := make(map[int]string)
+		for _, f := range g.Fields {
+			if f.Tag != "" {
+				if err := checkTag(f.Tag); err != nil {
+					report(f, "malformed tag `%s`: %s", f.Tag, err)
+					continue
+				}
+			}
+			for _, key := range flagTags {
+				if v := f.flag(key); v != "" && v != "true" && v != "false" {
+					report(f, "%s must be true or false, got %q", key, v)
+				}
+			}
+
+			switch {
+			case f.Json == "" || f.Json == "-":
+				report(f, "missing json name")
+			case names[f.Json] != "":
+				report(f, "json name %q is already used by %s", f.Json, names[f.Json])
+			default:
+				names[f.Json] = f.Name
+			}
+
+			switch {
+			case !g.knownType(f):
+				report(f, "unsupported type %q, available: %s, or declare it in types of %s", f.Type, strings.Join(fieldTypes, ","), defaultConfigFile)
+			case f.IsID() && f.Type != "int64":
+				report(f, "Id must be int64, got %s", f.Type)
+			case f.Time == "true" && !contains([]string{"int64", "time.Time", "*time.Time"}, f.Type):
+				report(f, "time field must be int64 or time.Time, got %s", f.Type)
+			}
+			switch {
+			case f.TimeFormat != "" && !f.IsTime():
+				report(f, "time_format is only allowed on time fields")
+			case f.TimeFormat != "" && !contains(timeFormats, f.TimeFormat):
+				report(f, "unknown time_format %q, available: %s", f.TimeFormat, strings.Join(timeFormats, ","))
+			}
+			switch {
+			case f.Nested != "" && f.Nested != "json" && f.Nested != "flatten":
+				report(f, "nested must be json or flatten, got %q", f.Nested)
+			case f.Nested != "" && !f.Object:
+				report(f, "nested is only allowed on structs defined in the dto package")
+			}
+			for _, pkg := range packages(f.Type) {
+				if _, ok := g.importPath(pkg); !ok {
+					report(f, "unknown package %s, declare its import path in imports of %s", pkg, defaultConfigFile)
+				}
+			}
+			if f.IsRequired() && !f.IsParameter() {
+				report(f, `required is only allowed on parameters, add parameter:"true"`)
+			}
+			if n, err := strconv.Atoi(f.Proto); f.Proto != "" && (err != nil || n < 1 || n > maxProtoNumber || n >= 19000 && n <= 19999) {
+				report(f, "proto must be a field number between 1 and %d except 19000-19999, got %q", maxProtoNumber, f.Proto)
+			} else if n = g.FieldNumber(f, 0); numbers[n] != "" {
+				report(f, "proto field number %d is already used by %s", n, numbers[n])
+			} else {
+				numbers[n] = f.Name
+			}
+		}
+
+		for _, r := range g.Relations {
+			f := r.Field
+			switch {
+			case !contains(relationKinds, r.Kind) || r.Target == "":
+				report(f, "rel must be <kind>:<Entity>, kind is one of %s, got %q", strings.Join(relationKinds, ","), f.Rel)
+				continue
+			case r.Entity == nil:
+				report(f, "rel refers to unknown entity %s", r.Target)
+				continue
+			case r.Kind == "belongs_to" && (f.Type != "int64" || r.Name == f.Name || r.Name == ""):
+				report(f, "belongs_to must be declared on an int64 foreign key named <Entity>Id, got %s %s", f.Name, f.Type)
+			case r.IsMany() && f.Type != "[]"+r.Target && f.Type != "[]*"+r.Target:
+				report(f, "%s field must be []%s, got %s", r.Kind, r.Target, f.Type)
+			case r.Kind == "has_many" && !hasForeignKey(r.Entity, r.ForeignKey):
+				report(f, "has_many requires int64 field %s in %s", r.ForeignKey, r.Target)
+			case r.Kind != "many_to_many" && strings.Count(f.Rel, ":") > 1:
+				report(f, "join table is only allowed on many_to_many, got %q", f.Rel)
+			case r.Kind == "many_to_many" && r.Target == g.TitleName:
+				report(f, "many_to_many between %s and itself is not supported", r.Target)
+			case r.Inverse && !(hasForeignKey(r.Join, r.OwnerKey()) && hasForeignKey(r.Join, r.TargetKey())):
+				report(f, "join table %s already joins %s and %s", r.JoinTable, r.Join.Fields[0].Name, r.Join.Fields[1].Name)
+			}
+			if names[r.Json] != "" && names[r.Json] != r.Name {
+				report(f, "json name %q of relation %s is already used by %s", r.Json, r.Name, names[r.Json])
+			}
+		}
+	}
+	return out
+}
+
+// hasForeignKey 实体中是否有 int64 类型的外键字段
+func hasForeignKey(g *Generate, name string) bool {
+	for _, f := range g.Fields {
+		if f.Name == name && f.Type == "int64" {
+			return true
+		}
+	}
+	return false
+}
+
+// flag 字段上取值为布尔值的标记
+func (f *Field) flag(key string) string {
+	return map[string]string{
+		"parameter": f.Parameter,
+		"required":  f.Required,
+		"time":      f.Time,
+		"index":     f.Index,
+		"unique":    f.Unique,
+	}[key]
+}
+
+// checkTag 检查 tag 是否为以空格分隔的 key:"value"，与 reflect.StructTag.Get 的解析规则一致
+func checkTag(tag string) error {
+	for tag != "" {
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		if tag = tag[i:]; tag == "" {
+			break
+		}
+
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			return fmt.Errorf("expected key:\"value\" at %q", tag)
+		}
+		key := tag[:i]
+		tag = tag[i+1:]
+
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			return fmt.Errorf("unterminated value of %s", key)
+		}
+		if _, err := strconv.Unquote(tag[:i+1]); err != nil {
+			return fmt.Errorf("invalid value of %s: %s", key, err)
+		}
+		if tag = tag[i+1:]; tag != "" && tag[0] != ' ' {
+			return fmt.Errorf("missing space after %s", key)
+		}
+	}
+	return nil
+}
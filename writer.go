@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// stateDir 生成器状态目录，位于项目根目录下，保存每次生成的原始内容用于三方合并
+const stateDir = ".generator"
+
+// status 文件生成结果
+type status string
+
+const (
+	statusCreated   status = "create"
+	statusUpdated   status = "update"
+	statusUnchanged status = "unchanged"
+	statusSkipped   status = "skip"
+	statusConflict  status = "conflict"
+)
+
+// plan 计算文件最终写入的内容
+//   - 文件不存在时直接创建
+//   - 多个实体共用的文件与已有内容合并
+//   - 存在上次生成的原始内容时，与手工修改后的文件、新生成的内容做三方合并
+//   - 否则只有包含受保护区域的文件才会重新生成，区域内的内容原样保留
+func plan(out *output) (status, []byte, error) {
+	var (
+		err  error
+		old  []byte
+		base []byte
+		src  = out.Src
+	)
+	if old, err = os.ReadFile(out.Path); err != nil {
+		if os.IsNotExist(err) {
+			return statusCreated, out.Src, nil
+		}
+		return "", nil, err
+	}
+
+	// 共用文件只替换本次生成的部分，不使用三方合并
+	if out.Merge != nil {
+		if src, err = out.Merge(old); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", out.Path, err)
+		}
+		if bytes.Equal(src, old) {
+			return statusUnchanged, old, nil
+		}
+		return statusUpdated, src, nil
+	}
+
+	if base, err = os.ReadFile(out.Baseline); err != nil && !os.IsNotExist(err) {
+		return "", nil, err
+	}
+	// 既没有原始内容也不包含受保护区域的文件视为手写文件，保持不变
+	if base == nil && !hasRegions(old) {
+		return statusSkipped, old, nil
+	}
+
+	if hasRegions(old) {
+		if src, err = keepRegions(src, old); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", out.Path, err)
+		}
+		if src, err = formatSource(out.Path, src); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", out.Path, err)
+		}
+	}
+
+	if base != nil {
+		var conflicts int
+		// 上次合并遗留的冲突未解决时同样视为冲突
+		if src, conflicts = merge3(base, old, src); conflicts > 0 || hasConflicts(src) {
+			return statusConflict, src, nil
+		}
+		// 文本合并成功但无法格式化时保留合并结果，由编译器提示问题
+		if formatted, err := formatSource(out.Path, src); err == nil {
+			src = formatted
+		}
+	}
+
+	if bytes.Equal(src, old) {
+		return statusUnchanged, old, nil
+	}
+	return statusUpdated, src, nil
+}
+
+// generate 写入生成文件，并保存本次生成的原始内容
+func generate(out *output) (status, error) {
+	st, src, err := plan(out)
+	if err != nil {
+		return "", err
+	}
+	if st == statusSkipped {
+		return st, nil
+	}
+	if st != statusUnchanged {
+		if err = writeFile(out.Path, src); err != nil {
+			return "", err
+		}
+	}
+	if out.Baseline == "" {
+		return st, nil
+	}
+	if err = writeFile(out.Baseline, out.Src); err != nil {
+		return "", err
+	}
+	return st, nil
+}
+
+// writeFile 写入文件，目录不存在时自动创建
+func writeFile(filename string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}